@@ -136,6 +136,7 @@ func main() {
 	// Start the Kafka metrics, heartbeat, and register consumers.
 	go orchestrator.RunHeartbeatConsumer()
 	go orchestrator.RunMetricsConsumer()
+	go orchestrator.RunTestTimeouts()
 
 	// Create a new gin router
 	router := gin.Default()
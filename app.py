@@ -9,8 +9,28 @@ orchestrator_url = "http://localhost:8081/"
 class LoadTestRequest(BaseModel):
     test_type: str
     test_server: str = "http://localhost:8080/ping"
-    test_message_delay: int
-    message_count_per_driver: int
+    test_message_delay: int = 0
+    message_count_per_driver: int = 0
+    ramp_start_rps: float = 0
+    ramp_target_rps: float = 0
+    ramp_duration_seconds: int = 0
+    hold_duration_seconds: int = 0
+    stages: list[dict] = []
+    arrival_rate: float = 0
+    max_in_flight: int = 0
+    virtual_users: int = 0
+    iterations_per_user: int = 0
+    duration_seconds: int = 0
+    think_time: dict | None = None
+    graceful_drain_seconds: int = 0
+    arrival: dict | None = None
+    request: dict | None = None
+    requests: list[dict] = []
+    steps: list[dict] = []
+    data_feed: dict | None = None
+    metrics_interval_ms: int = 0
+    thresholds: list[str] = []
+    abort_on: list[str] = []
     
 class TestConfig(BaseModel):
     TestType: str    
@@ -82,7 +102,119 @@ async def retrieve_all_metrics():
     except httpx.RequestError:
         # Handle other request errors
         raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.get("/tests")
+async def retrieve_tests():
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.get(f"{orchestrator_url}tests")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.get("/tests/{test_id}")
+async def retrieve_test(test_id: str):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.get(f"{orchestrator_url}tests/{test_id}")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.get("/tests/{test_id}/timeseries")
+async def retrieve_test_timeseries(test_id: str):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.get(f"{orchestrator_url}tests/{test_id}/timeseries")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.get("/tests/{test_id}/verdict")
+async def retrieve_test_verdict(test_id: str):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.get(f"{orchestrator_url}tests/{test_id}/verdict")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.get("/tests/{test_id}/summary")
+async def retrieve_test_summary(test_id: str):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.get(f"{orchestrator_url}tests/{test_id}/summary")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
     
+@app.post("/tests/{test_id}/stop")
+async def stop_test(test_id: str, mode: str = "stop"):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.post(f"{orchestrator_url}tests/{test_id}/stop", params={"mode": mode})
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.post("/tests/{test_id}/pause")
+async def pause_test(test_id: str):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.post(f"{orchestrator_url}tests/{test_id}/pause")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
+@app.post("/tests/{test_id}/resume")
+async def resume_test(test_id: str):
+    try:
+        async with httpx.AsyncClient() as client:
+            response = await client.post(f"{orchestrator_url}tests/{test_id}/resume")
+            response.raise_for_status()  # Raise an exception for 4xx or 5xx responses
+            return response.json()
+    except httpx.HTTPError as exc:
+        # Handle HTTP errors
+        raise HTTPException(status_code=exc.response.status_code, detail="HTTP Error occurred")
+    except httpx.RequestError:
+        # Handle other request errors
+        raise HTTPException(status_code=500, detail="Request Error occurred")
+
 @app.get("/heartbeat/{nodeid}")
 async def retrieve_heartbeat(nodeid: str):
     try:
@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// arrivalProcess produces the gaps between consecutive requests of a
+// rate-based executor. Implementations are used from a single goroutine.
+type arrivalProcess interface {
+	// next returns how long to wait before the next request when running at
+	// rate requests per second.
+	next(rate float64) time.Duration
+}
+
+// newArrivalProcess returns the arrival process described by arrival,
+// defaulting to evenly spaced requests.
+func newArrivalProcess(arrival *kafka.ArrivalDistribution) arrivalProcess {
+	if arrival == nil {
+		return constantArrivals{}
+	}
+
+	switch arrival.Type {
+	case "poisson":
+		return poissonArrivals{}
+	case "uniform":
+		return uniformArrivals{jitter: arrival.JitterPercent / 100}
+	case "burst":
+		return &burstArrivals{size: arrival.BurstSize}
+	default:
+		return constantArrivals{}
+	}
+}
+
+// meanGap returns the average gap between requests at rate requests per second.
+func meanGap(rate float64) time.Duration {
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// constantArrivals spaces requests evenly.
+type constantArrivals struct{}
+
+func (constantArrivals) next(rate float64) time.Duration {
+	return meanGap(rate)
+}
+
+// poissonArrivals draws exponentially distributed gaps, which makes the
+// number of requests per interval follow a Poisson distribution.
+type poissonArrivals struct{}
+
+func (poissonArrivals) next(rate float64) time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(meanGap(rate)))
+}
+
+// uniformArrivals jitters the mean gap uniformly by up to the jitter fraction
+// in either direction.
+type uniformArrivals struct {
+	jitter float64
+}
+
+func (u uniformArrivals) next(rate float64) time.Duration {
+	factor := 1 + u.jitter*(2*rand.Float64()-1)
+	return time.Duration(factor * float64(meanGap(rate)))
+}
+
+// burstArrivals sends requests in bursts of size back to back requests, with
+// the pause between bursts chosen to keep the average rate.
+type burstArrivals struct {
+	size int
+	sent int
+}
+
+func (b *burstArrivals) next(rate float64) time.Duration {
+	b.sent++
+	if b.sent < b.size {
+		return 0
+	}
+	b.sent = 0
+	return time.Duration(b.size) * meanGap(rate)
+}
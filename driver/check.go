@@ -0,0 +1,102 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// checker asserts something about every response to a request.
+type checker struct {
+	name       string
+	typ        string
+	status     []int
+	value      string
+	path       string
+	regex      *regexp.Regexp
+	maxLatency time.Duration
+	maxBytes   int
+}
+
+// newChecker prepares spec for the request named requestName. The value of a
+// body_regex check compiles to regex.
+func newChecker(spec kafka.Check, requestName string, regex *regexp.Regexp) (checker, error) {
+	c := checker{
+		name:       spec.Name,
+		typ:        spec.Type,
+		status:     spec.Status,
+		value:      spec.Value,
+		path:       spec.Path,
+		regex:      regex,
+		maxLatency: time.Duration(spec.MaxLatencyMs) * time.Millisecond,
+		maxBytes:   spec.MaxBytes,
+	}
+	if c.name == "" {
+		c.name = requestName + " " + spec.Type
+	}
+
+	switch spec.Type {
+	case "status", "body_contains", "body_regex", "json_path", "max_latency", "max_body_size":
+	default:
+		return checker{}, fmt.Errorf("unknown check type %q for %s", spec.Type, c.name)
+	}
+	return c, nil
+}
+
+// check returns nil if resp, its body and latency pass the check and the
+// reason they did not otherwise.
+func (c checker) check(resp *http.Response, body []byte, latency time.Duration) error {
+	switch c.typ {
+	case "status":
+		if len(c.status) == 0 {
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("status %d is not 2xx", resp.StatusCode)
+			}
+			return nil
+		}
+		for _, status := range c.status {
+			if resp.StatusCode == status {
+				return nil
+			}
+		}
+		return fmt.Errorf("status %d is not one of %v", resp.StatusCode, c.status)
+	case "body_contains":
+		if !bytes.Contains(body, []byte(c.value)) {
+			return fmt.Errorf("body does not contain %q", c.value)
+		}
+	case "body_regex":
+		if !c.regex.Match(body) {
+			return fmt.Errorf("body does not match %q", c.value)
+		}
+	case "json_path":
+		value, err := jsonPathValue(body, c.path)
+		if err != nil {
+			return err
+		}
+		if value != c.value {
+			return fmt.Errorf("json path %q is %q, want %q", c.path, value, c.value)
+		}
+	case "max_latency":
+		if latency > c.maxLatency {
+			return fmt.Errorf("latency %v exceeds %v", latency, c.maxLatency)
+		}
+	case "max_body_size":
+		if len(body) > c.maxBytes {
+			return fmt.Errorf("body size %d exceeds %d bytes", len(body), c.maxBytes)
+		}
+	}
+	return nil
+}
+
+// needsBody reports whether the check inspects the response body.
+func (c checker) needsBody() bool {
+	switch c.typ {
+	case "status", "max_latency":
+		return false
+	}
+	return true
+}
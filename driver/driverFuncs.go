@@ -1,28 +1,54 @@
 package driver
 
 import (
+	"context"
+	"fmt"
 	"github.com/ankush-003/distributed-load-testing/kafka"
+	"io"
 	"time"
 	"log"
 	"sync"
+	"sync/atomic"
 	"net/http"
+	"net/http/httptrace"
 )
 
-func WaitForTestConfig(testConfigTopic string, triggerTopic string, consumer *kafka.Consumer, testConfigChan chan<- kafka.TestConfigMessage, triggerReceived chan struct{}, logger *log.Logger) {
-	testConfigMsgChan := make(chan kafka.TestConfigMessage)
-	doneChan := make(chan struct{})
+// WaitForTestConfig hands the driver one test at a time. It sends the config
+// of each triggered test on testConfigChan, then waits on idle for the driver
+// to finish the test before accepting the next config. Configs published
+// while a test runs are read once it is over, the consumer resuming after the
+// last config it read. It closes testConfigChan and returns when the
+// consumer stops on interrupt.
+func WaitForTestConfig(testConfigTopic string, triggerTopic string, consumer *kafka.Consumer, testConfigChan chan<- kafka.TestConfigMessage, idle <-chan struct{}, logger *log.Logger) {
+	defer close(testConfigChan)
 
-	go func() {
-		defer close(testConfigMsgChan)
-		defer close(doneChan)
-		consumer.ConsumeTestConfigAndTriggerMessages(testConfigTopic, triggerTopic, testConfigMsgChan, triggerReceived)
-	}()
+	for {
+		testConfigMsgChan := make(chan kafka.TestConfigMessage)
+		triggerReceived := make(chan struct{})
+		doneChan := make(chan struct{})
+
+		go func() {
+			defer close(doneChan)
+			consumer.ConsumeTestConfigAndTriggerMessages(testConfigTopic, triggerTopic, testConfigMsgChan, triggerReceived)
+		}()
+
+		var testConfigMsg kafka.TestConfigMessage
+	WaitLoop:
+		for {
+			select {
+			case testConfigMsg = <-testConfigMsgChan:
+				logger.Printf("Test %s configured, waiting for its trigger\n", testConfigMsg.TestID)
+			case <-triggerReceived:
+				<-doneChan // Wait for the consumer to release the topics
+				break WaitLoop
+			case <-doneChan:
+				logger.Println("Stopped waiting for test configs")
+				return
+			}
+		}
 
-	select {
-	case testConfigMsg := <-testConfigMsgChan:
 		testConfigChan <- testConfigMsg
-	case <-time.After(1 * time.Minute):
-		logger.Println("No test config message received within the timeout")
+		<-idle
 	}
 }
 
@@ -40,85 +66,452 @@ func HandleTestConfig(testConfigMsg kafka.TestConfigMessage, driverNode *DriverN
 	logger.Println("Driver Node Info:", driverNode)
 }
 
-func HandleTrigger(metricsTopic string,driverNode *DriverNode, testConfigMsg *kafka.TestConfigMessage, producer *kafka.Producer, metricsStore *MetricsStore, logger *log.Logger) {
-	done := make(chan struct{})
+func HandleTrigger(metricsTopic string,driverNode *DriverNode, testConfigMsg *kafka.TestConfigMessage, producer *kafka.Producer, metricsStore *MetricsStore, control <-chan kafka.TriggerMessage, logger *log.Logger) {
+	done := NewLatch() // the test is over, stop reporting it
+	stop := NewLatch() // stop sending requests, letting those in flight drain
+	abort := make(chan struct{})
+	pause := NewPauseGate()
+
+	// Forget the previous test before reporting metrics for this one
+	metricsStore.StartTest()
+
+	metricsStore.AcknowledgeTest(producer, metricsTopic, driverNode, logger)
+
+	// However the test ends, report a final window so the orchestrator knows
+	// this driver is done with it, and why it could not run it if so
+	var testErr error
+	defer func() {
+		done.close()
+		metricsStore.ProduceMetricsToTopicOnce(producer, metricsTopic, driverNode, testErr, logger)
+	}()
+
+	// Stop, pause or resume the test when the orchestrator says so
+	go func() {
+		aborted := false
+		for {
+			select {
+			case msg := <-control:
+				switch msg.Trigger {
+				case kafka.TriggerStop:
+					logger.Printf("Test %s stopped by the orchestrator\n", msg.TestID)
+					stop.close()
+				case kafka.TriggerPause:
+					if pause.pause() {
+						metricsStore.SetPaused(true)
+						logger.Printf("Test %s paused by the orchestrator\n", msg.TestID)
+					}
+				case kafka.TriggerResume:
+					if pause.resume() {
+						metricsStore.SetPaused(false)
+						logger.Printf("Test %s resumed by the orchestrator\n", msg.TestID)
+					}
+				case kafka.TriggerAbort:
+					logger.Printf("Test %s aborted by the orchestrator\n", msg.TestID)
+					if !aborted {
+						aborted = true
+						close(abort) // Cancel in-flight requests without draining them
+					}
+					done.close()
+				}
+			case <-done.closed():
+				return
+			}
+		}
+	}()
 
 	// Start a goroutine for continuous metrics calculation and sending
 	go func() {
 		//defer close(done)
-		metricsStore.ProduceMetricsToTopic(done, producer, metricsTopic, driverNode, logger)
+		interval := time.Duration(testConfigMsg.MetricsIntervalMs) * time.Millisecond
+		metricsStore.ProduceMetricsToTopic(done.closed(), producer, metricsTopic, driverNode, interval, logger)
 	}()
 	
+	scenario, err := NewScenario(testConfigMsg, driverNode, logger)
+	if err != nil {
+		logger.Printf("Invalid request spec: %s\n", err)
+		testErr = fmt.Errorf("invalid request spec: %w", err)
+		done.close()
+		return
+	}
+
+	// Stop the test like the orchestrator would once its unique rows run out
+	go func() {
+		select {
+		case <-scenario.Exhausted():
+			stop.close()
+		case <-done.closed():
+		}
+	}()
+
+	duration := time.Duration(testConfigMsg.DurationSeconds) * time.Second
+	drain := time.Duration(testConfigMsg.GracefulDrainSeconds) * time.Second
+
 	if driverNode.TestType == "AVALANCHE" {
 		logger.Println("Starting Load Test!")
-		AvalancheTesting(driverNode.TestServer, metricsStore, driverNode.MessageCountPerDriver, done, logger)
-		metricsStore.ProduceMetricsToTopicOnce(producer, metricsTopic, driverNode, logger)
+		AvalancheTesting(scenario, metricsStore, driverNode.MessageCountPerDriver, duration, drain, done, stop.closed(), abort, pause, logger)
 	} else if driverNode.TestType == "TSUNAMI" {
 		logger.Println("Starting Load Test!")
-		TsunamiTesting(driverNode.TestServer, metricsStore, driverNode.TestMessageDelay, driverNode.MessageCountPerDriver, done, logger)
-		metricsStore.ProduceMetricsToTopicOnce(producer, metricsTopic, driverNode, logger)
+		TsunamiTesting(scenario, metricsStore, driverNode.TestMessageDelay, testConfigMsg.Arrival, driverNode.MessageCountPerDriver, duration, drain, done, stop.closed(), abort, pause, logger)
+	} else if driverNode.TestType == "RAMP" {
+		logger.Println("Starting Load Test!")
+		rampDuration := time.Duration(testConfigMsg.RampDurationSeconds) * time.Second
+		holdDuration := time.Duration(testConfigMsg.HoldDurationSeconds) * time.Second
+		RampTesting(scenario, metricsStore, testConfigMsg.RampStartRPS, testConfigMsg.RampTargetRPS, rampDuration, holdDuration, testConfigMsg.MaxInFlight, testConfigMsg.Arrival, drain, done, stop.closed(), abort, pause, logger)
+	} else if driverNode.TestType == "STAGED" {
+		logger.Println("Starting Load Test!")
+		StagedTesting(scenario, metricsStore, testConfigMsg.Stages, testConfigMsg.MaxInFlight, testConfigMsg.Arrival, drain, done, stop.closed(), abort, pause, logger)
+	} else if driverNode.TestType == "CONSTANT_ARRIVAL_RATE" {
+		logger.Println("Starting Load Test!")
+		ConstantArrivalRateTesting(scenario, metricsStore, testConfigMsg.ArrivalRate, testConfigMsg.MaxInFlight, testConfigMsg.Arrival, driverNode.MessageCountPerDriver, duration, drain, done, stop.closed(), abort, pause, logger)
+	} else if driverNode.TestType == "VIRTUAL_USERS" {
+		logger.Println("Starting Load Test!")
+		VirtualUserTesting(scenario, metricsStore, testConfigMsg.VirtualUsers, testConfigMsg.IterationsPerUser, duration, drain, testConfigMsg.ThinkTime, done, stop.closed(), abort, pause, logger)
 	} else {
-		logger.Panic("Invalid Test Type")
+		// Stay up for the next test
+		logger.Printf("Invalid test type %q\n", driverNode.TestType)
+		testErr = fmt.Errorf("invalid test type %q", driverNode.TestType)
+		done.close()
 	}
 }
 
-func AvalancheTesting(ServerURL string, metricsStore *MetricsStore, requestCount int, done chan struct{}, logger *log.Logger) {
+// Latch is a channel closed once, by whichever of the executors and the
+// control goroutine of HandleTrigger gets there first.
+type Latch struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+func NewLatch() *Latch {
+	return &Latch{c: make(chan struct{})}
+}
+
+// close closes the latch. It returns false if it was already closed.
+func (l *Latch) close() bool {
+	closed := false
+	l.once.Do(func() {
+		close(l.c)
+		closed = true
+	})
+	return closed
+}
+
+// closed returns a channel closed once the latch is.
+func (l *Latch) closed() <-chan struct{} {
+	return l.c
+}
+
+// AvalancheTesting sends requestCount requests at once. When duration is
+// set, waves of requestCount concurrent requests are sent back to back until
+// it elapses.
+func AvalancheTesting(scenario *Scenario, metricsStore *MetricsStore, requestCount int, duration, drain time.Duration, done *Latch, stopRequested <-chan struct{}, abort <-chan struct{}, pause *PauseGate, logger *log.Logger) {
 	var wg sync.WaitGroup
+	stop, ctx, release := testWindow(duration, drain, stopRequested, abort, pause)
+	defer release()
 
-	// Sending concurrent HTTP requests
-	for i := 0; i < requestCount; i++ {
-		wg.Add(1)
-		go func(reqNum int) {
-			defer wg.Done()
-			SendHTTPRequest(ServerURL, reqNum, metricsStore, logger)
-		}(i)
+	requestNumber := 0
+
+AvalancheLoop:
+	for {
+		var wave sync.WaitGroup
+
+		if _, ok := pause.wait(stop); !ok {
+			break AvalancheLoop
+		}
+
+		// Sending concurrent HTTP requests
+		for i := 0; i < requestCount; i++ {
+			wg.Add(1)
+			wave.Add(1)
+			go func(reqNum int) {
+				defer wg.Done()
+				defer wave.Done()
+				SendHTTPRequest(ctx, scenario, reqNum, "", metricsStore, logger)
+			}(requestNumber)
+			requestNumber++
+		}
+
+		if duration <= 0 {
+			break AvalancheLoop
+		}
+
+		wave.Wait() // Wait for the wave to complete before sending the next one
+		select {
+		case <-stop:
+			break AvalancheLoop
+		default:
+		}
 	}
 
 	wg.Wait() // Wait for all requests to be sent
 
-	// When testing is completed, signal to stop metrics calculation and sending
-	close(done)
+	if !done.close() {
+		return
+	}
 	logger.Println("Avalanche testing completed")
 	log.Println("Avalanche testing completed")
 }
 
-func TsunamiTesting(ServerURL string, metricsStore *MetricsStore, interval int, requestCount int, done chan struct{}, logger *log.Logger) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
-	defer ticker.Stop()
+// TsunamiTesting sends requests one after the other, spaced by interval
+// milliseconds on average according to arrival, until requestCount requests
+// have been sent or duration has elapsed; a zero value disables either limit.
+func TsunamiTesting(scenario *Scenario, metricsStore *MetricsStore, interval int, arrival *kafka.ArrivalDistribution, requestCount int, duration, drain time.Duration, done *Latch, stopRequested <-chan struct{}, abort <-chan struct{}, pause *PauseGate, logger *log.Logger) {
+	arrivals := newArrivalProcess(arrival)
+	rate := float64(time.Second) / float64(time.Duration(interval)*time.Millisecond)
+	metricsStore.SetTargetRPS(rate)
+	next := time.Now().Add(arrivals.next(rate))
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	stop, ctx, release := testWindow(duration, drain, stopRequested, abort, pause)
+	defer release()
 
-	for i := 1; i <= requestCount; i++ {
+TsunamiLoop:
+	for i := 1; requestCount <= 0 || i <= requestCount; i++ {
 		select {
-		case <-ticker.C:
-			SendHTTPRequest(ServerURL, i, metricsStore, logger)
-		case <-done:
-			return
+		case <-timer.C:
+		case <-stop:
+			break TsunamiLoop
+		}
+
+		// Shift the schedule by the pause rather than catching up on it
+		paused, ok := pause.wait(stop)
+		if !ok {
+			break TsunamiLoop
 		}
+		next = next.Add(paused)
+		SendHTTPRequest(ctx, scenario, i, "", metricsStore, logger)
+
+		// Like a ticker, skip the sends a slow response made us miss
+		next = next.Add(arrivals.next(rate))
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		timer.Reset(time.Until(next))
 	}
 
-	// When testing is completed, signal to stop metrics calculation and sending
-	close(done)
+	if !done.close() {
+		return
+	}
 	logger.Println("Tsunami testing completed")
 	log.Println("Tsunami testing completed")
 }
 
-func SendHTTPRequest(url string, requestNumber int, metricsStore *MetricsStore, logger *log.Logger) {
-	start := time.Now()
-	resp, err := http.Get(url)
-	if err != nil {
-		logger.Printf("Error making request: %s\n", err)
+func RampTesting(scenario *Scenario, metricsStore *MetricsStore, startRPS, targetRPS float64, rampDuration, holdDuration time.Duration, maxInFlight int, arrival *kafka.ArrivalDistribution, drain time.Duration, done *Latch, stopRequested <-chan struct{}, abort <-chan struct{}, pause *PauseGate, logger *log.Logger) {
+	stop, ctx, release := testWindow(0, drain, stopRequested, abort, pause)
+	defer release()
+	executor := newRateExecutor(ctx, scenario, metricsStore, maxInFlight, arrival, pause, logger)
+
+	rateAt := func(elapsed time.Duration) float64 {
+		return rampRate(startRPS, targetRPS, rampDuration, elapsed)
+	}
+	executor.run("", rateAt, rampDuration+holdDuration, 0, stop)
+
+	executor.wait() // Wait for in-flight requests to finish
+
+	if !done.close() {
 		return
 	}
-	defer resp.Body.Close()
+	logger.Printf("Ramp testing completed, %d requests sent\n", executor.requestsSent())
+	log.Println("Ramp testing completed")
+}
 
-	duration := time.Since(start)
+// ConstantArrivalRateTesting sends requests at arrivalRate requests per
+// second, independently of how fast the server responds, until requestCount
+// requests have been sent or duration has elapsed; a zero value disables
+// either limit. At most maxInFlight requests are outstanding at once, zero
+// meaning no cap.
+func ConstantArrivalRateTesting(scenario *Scenario, metricsStore *MetricsStore, arrivalRate float64, maxInFlight int, arrival *kafka.ArrivalDistribution, requestCount int, duration, drain time.Duration, done *Latch, stopRequested <-chan struct{}, abort <-chan struct{}, pause *PauseGate, logger *log.Logger) {
+	stop, ctx, release := testWindow(duration, drain, stopRequested, abort, pause)
+	defer release()
+	executor := newRateExecutor(ctx, scenario, metricsStore, maxInFlight, arrival, pause, logger)
+
+	rateAt := func(time.Duration) float64 {
+		return arrivalRate
+	}
+	executor.run("", rateAt, 0, requestCount, stop)
 
-	// Store latency in MetricsStore with request number
-	if err := metricsStore.StoreLatency(requestNumber, duration); err != nil {
-		logger.Printf("Error storing latency for request %d: %s\n", requestNumber, err)
+	executor.wait() // Wait for in-flight requests to finish
+
+	if !done.close() {
 		return
 	}
+	logger.Printf("Constant arrival rate testing completed, %d requests sent\n", executor.requestsSent())
+	log.Println("Constant arrival rate testing completed")
+}
+
+// VirtualUserTesting runs users looping virtual users. Each user sends a
+// request, waits for the response, pauses for a think time and repeats until
+// it has sent iterations requests or duration has elapsed; a zero value
+// disables either limit.
+func VirtualUserTesting(scenario *Scenario, metricsStore *MetricsStore, users int, iterations int, duration, drain time.Duration, thinkTime *kafka.ThinkTime, done *Latch, stopRequested <-chan struct{}, abort <-chan struct{}, pause *PauseGate, logger *log.Logger) {
+	var wg sync.WaitGroup
+	var requestCounter int64
+
+	// Users stop at the deadline even while thinking
+	stop, ctx, release := testWindow(duration, drain, stopRequested, abort, pause)
+	defer release()
+
+	for u := 0; u < users; u++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; iterations <= 0 || i < iterations; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, ok := pause.wait(stop); !ok {
+					return
+				}
+
+				reqNum := int(atomic.AddInt64(&requestCounter, 1))
+				SendHTTPRequest(ctx, scenario, reqNum, "", metricsStore, logger)
+
+				select {
+				case <-time.After(thinkTimeDuration(thinkTime)):
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait() // Wait for every user to finish
+
+	if !done.close() {
+		return
+	}
+	logger.Printf("Virtual user testing completed, %d requests sent\n", requestCounter)
+	log.Println("Virtual user testing completed")
+}
+
+// stageName returns the name metrics for the i-th stage are tagged with.
+func stageName(stage kafka.Stage, i int) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+	return fmt.Sprintf("stage-%d", i+1)
+}
+
+// StagedTesting executes stages in order. Rate stages ramp linearly from the
+// previous stage's target rate (zero for the first stage or after a
+// concurrency stage) to their own target, concurrency stages run a fixed
+// number of workers sending requests back to back.
+func StagedTesting(scenario *Scenario, metricsStore *MetricsStore, stages []kafka.Stage, maxInFlight int, arrival *kafka.ArrivalDistribution, drain time.Duration, done *Latch, stopRequested <-chan struct{}, abort <-chan struct{}, pause *PauseGate, logger *log.Logger) {
+	stop, ctx, release := testWindow(0, drain, stopRequested, abort, pause)
+	defer release()
+	executor := newRateExecutor(ctx, scenario, metricsStore, maxInFlight, arrival, pause, logger)
+	previousRPS := 0.0
+
+	for i, stage := range stages {
+		name := stageName(stage, i)
+		duration := time.Duration(stage.DurationSeconds) * time.Second
+		metricsStore.SetStage(name)
+		logger.Printf("Starting stage %s\n", name)
+
+		var completed bool
+		if stage.Concurrency > 0 {
+			metricsStore.SetTargetRPS(0)
+			completed = sendConcurrently(ctx, scenario, metricsStore, name, stage.Concurrency, duration, &executor.requestCounter, pause, stop, logger)
+			previousRPS = 0
+		} else {
+			fromRPS, toRPS := previousRPS, stage.TargetRPS
+			rateAt := func(elapsed time.Duration) float64 {
+				return rampRate(fromRPS, toRPS, duration, elapsed)
+			}
+			completed = executor.run(name, rateAt, duration, 0, stop)
+			previousRPS = stage.TargetRPS
+		}
+
+		if !completed {
+			break
+		}
+	}
 
-	logger.Printf("Response Status: %s, Latency for request %d: %v\n", resp.Status, requestNumber, duration)
+	executor.wait() // Wait for in-flight requests to finish
+
+	if !done.close() {
+		return
+	}
+	logger.Printf("Staged testing completed, %d requests sent\n", executor.requestsSent())
+	log.Println("Staged testing completed")
+}
+
+func SendHTTPRequest(ctx context.Context, scenario *Scenario, requestNumber int, stage string, metricsStore *MetricsStore, logger *log.Logger) {
+	sendHTTPRequestAt(ctx, scenario, requestNumber, stage, time.Now(), metricsStore, logger)
+}
+
+// sendHTTPRequestAt runs one iteration of the scenario, a single request or
+// a journey, with latency measured from intendedStart, the time the
+// iteration was scheduled to start.
+func sendHTTPRequestAt(ctx context.Context, scenario *Scenario, requestNumber int, stage string, intendedStart time.Time, metricsStore *MetricsStore, logger *log.Logger) {
+	if len(scenario.steps) > 0 {
+		scenario.runJourney(ctx, requestNumber, stage, intendedStart, metricsStore, logger)
+		return
+	}
+
+	row, ok := scenario.row()
+	if !ok {
+		return
+	}
+	request := scenario.pick()
+	if _, _, err := sendRequest(ctx, request, row, requestNumber, stage, scenario.endpoint(request), intendedStart, metricsStore, logger); err != nil {
+		logger.Printf("Error sending request %d: %s\n", requestNumber, err)
+	}
+}
+
+// sendRequest sends request with vars and requestNumber substituted, records
+// its latency, measured from intendedStart until the body is read, and the
+// time spent in each phase under stage and endpoint, and runs its checks.
+// When the request extracts values from its response or checks its body, the
+// body is returned as well.
+func sendRequest(ctx context.Context, request *preparedRequest, vars map[string]string, requestNumber int, stage string, endpoint string, intendedStart time.Time, metricsStore *MetricsStore, logger *log.Logger) (*http.Response, []byte, error) {
+	req, err := request.newHTTPRequest(vars, requestNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	timer := &phaseTimer{}
+	resp, err := http.DefaultClient.Do(req.WithContext(httptrace.WithClientTrace(ctx, timer.trace())))
+	if err != nil {
+		metricsStore.StoreError(stage, endpoint, err)
+		return nil, nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read the whole body so the latency includes its transfer, keeping it
+	// only when it is needed
+	var body []byte
+	var bodySize int64
+	if request.readsBody() {
+		body, err = io.ReadAll(resp.Body)
+		bodySize = int64(len(body))
+	} else {
+		bodySize, err = io.Copy(io.Discard, resp.Body)
+	}
+	end := time.Now()
+	if err != nil {
+		metricsStore.StoreError(stage, endpoint, err)
+		return resp, nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	duration := end.Sub(intendedStart)
+
+	metricsStore.StoreLatency(stage, endpoint, duration)
+	metricsStore.StorePhases(stage, endpoint, timer.phases(end))
+	metricsStore.StoreBytes(stage, endpoint, requestSize(req), responseHeaderSize(resp)+bodySize)
+	metricsStore.StoreStatus(stage, endpoint, resp.StatusCode)
+
+	logger.Printf("Response Status: %s, Latency for request %d (%s): %v\n", resp.Status, requestNumber, request.name, duration)
+
+	for _, c := range request.checks {
+		err := c.check(resp, body, duration)
+		metricsStore.RecordCheck(c.name, err == nil)
+		if err != nil {
+			logger.Printf("Check %s failed for request %d: %s\n", c.name, requestNumber, err)
+		}
+	}
+	return resp, body, nil
 }
 
 func SendHeartbeats(heartbeatTopic string,driverNode *DriverNode, producer *kafka.Producer, done <-chan struct{}, logger *log.Logger) {
@@ -0,0 +1,109 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	// Errors as the HTTP client returns them, wrapped in a *url.Error
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://server/", Err: err}
+	}
+	dial := func(err error) error {
+		return wrap(&net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: err}})
+	}
+
+	tests := []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{"canceled", wrap(context.Canceled), "canceled"},
+		{"client timeout", wrap(context.DeadlineExceeded), "timeout"},
+		{"read timeout", wrap(&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}), "timeout"},
+		{"refused", dial(syscall.ECONNREFUSED), "connection_refused"},
+		{"dns", wrap(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}}), "dns"},
+		{"untrusted certificate", wrap(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), "tls"},
+		{"wrong host", wrap(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "server"}), "tls"},
+		{"expired certificate", wrap(x509.CertificateInvalidError{Reason: x509.Expired}), "tls"},
+		{"not tls", wrap(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), "tls"},
+		{"alert", wrap(&net.OpError{Op: "remote error", Err: tls.AlertError(40)}), "tls"},
+		{"reset", wrap(&net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}), "reset"},
+		{"closed", wrap(io.EOF), "reset"},
+		{"truncated body", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), "reset"},
+		{"tls in message only", errors.New("tls: not really"), "other"},
+		{"other", wrap(errors.New("unsupported protocol scheme")), "other"},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.class {
+			t.Errorf("%s: classifyError(%v) = %s, want %s", tt.name, tt.err, got, tt.class)
+		}
+	}
+}
+
+func TestClassifyRequestErrors(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slowServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	tests := []struct {
+		name  string
+		url   string
+		class string
+	}{
+		{"untrusted certificate", tlsServer.URL, "tls"},
+		{"timeout", slowServer.URL, "timeout"},
+		{"refused", closedURL, "connection_refused"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: request succeeded", tt.name)
+			continue
+		}
+		if got := classifyError(err); got != tt.class {
+			t.Errorf("%s: classifyError(%v) = %s, want %s", tt.name, err, got, tt.class)
+		}
+	}
+}
+
+func TestErrorStatusesAreErrorsWithoutClass(t *testing.T) {
+	metricsStore := NewMetricsStore()
+	metricsStore.StartTest()
+	metricsStore.StoreStatus("", "", http.StatusOK)
+	metricsStore.StoreStatus("", "", http.StatusNotFound)
+	metricsStore.StoreStatus("", "", http.StatusServiceUnavailable)
+	metricsStore.StoreError("", "", &url.Error{Op: "Get", URL: "http://server/", Err: context.Canceled})
+
+	all := metricsStore.scopes[""]
+	if all.requests != 3 || all.errors != 2 || all.canceled != 1 {
+		t.Errorf("%d requests, %d errors and %d canceled, want 3, 2 and 1", all.requests, all.errors, all.canceled)
+	}
+	if len(all.errorClasses) != 0 {
+		t.Errorf("error classes %v, want none for responses", all.errorClasses)
+	}
+}
@@ -0,0 +1,113 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// extractor pulls a value out of a response into a variable for later steps.
+type extractor struct {
+	name       string
+	from       string
+	expression string
+	regex      *regexp.Regexp
+}
+
+// newExtractor prepares spec, whose expression compiles to regex if it is a
+// regular expression.
+func newExtractor(spec kafka.Extraction, regex *regexp.Regexp) (extractor, error) {
+	e := extractor{name: spec.Name, from: spec.From, expression: spec.Expression, regex: regex}
+	switch spec.From {
+	case "json", "header", "regex":
+	default:
+		return extractor{}, fmt.Errorf("unknown extraction source %q for %s", spec.From, spec.Name)
+	}
+	return e, nil
+}
+
+// extract returns the value e selects from resp and its body.
+func (e extractor) extract(resp *http.Response, body []byte) (string, error) {
+	switch e.from {
+	case "header":
+		value := resp.Header.Get(e.expression)
+		if value == "" {
+			return "", fmt.Errorf("%s: header %q not found", e.name, e.expression)
+		}
+		return value, nil
+	case "regex":
+		// Use the first capture group if there is one, the whole match otherwise
+		match := e.regex.FindSubmatch(body)
+		if match == nil {
+			return "", fmt.Errorf("%s: regex %q did not match", e.name, e.expression)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	default:
+		value, err := jsonPathValue(body, e.expression)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", e.name, err)
+		}
+		return value, nil
+	}
+}
+
+// jsonPathValue returns the value at a dotted path such as "data.items.0.id"
+// in a JSON document. A leading "$." is accepted. Strings are returned as is,
+// other values as their JSON encoding.
+func jsonPathValue(body []byte, path string) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("response is not JSON: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", fmt.Errorf("response is not JSON: data after the first value")
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch node := value.(type) {
+			case map[string]interface{}:
+				child, ok := node[key]
+				if !ok {
+					return "", fmt.Errorf("json path %q: key %q not found", path, key)
+				}
+				value = child
+			case []interface{}:
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 || index >= len(node) {
+					return "", fmt.Errorf("json path %q: invalid index %q", path, key)
+				}
+				value = node[index]
+			default:
+				return "", fmt.Errorf("json path %q: cannot descend into %q", path, key)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
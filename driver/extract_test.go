@@ -0,0 +1,122 @@
+package driver
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+func TestJSONPathValue(t *testing.T) {
+	body := []byte(`{
+		"token": "abc",
+		"count": 12345678901234567890,
+		"ratio": 0.5,
+		"ok": true,
+		"none": null,
+		"data": {"items": [{"id": 7, "tags": ["a", "b"]}, {"id": "x"}]}
+	}`)
+
+	tests := []struct {
+		path  string
+		value string
+	}{
+		{"token", "abc"},
+		{"$.token", "abc"},
+		{"count", "12345678901234567890"},
+		{"ratio", "0.5"},
+		{"ok", "true"},
+		{"none", "null"},
+		{"data.items.0.id", "7"},
+		{"data.items.1.id", "x"},
+		{"data.items.0.tags.1", "b"},
+		{"data.items.0.tags", `["a","b"]`},
+		{"data.items.1", `{"id":"x"}`},
+	}
+	for _, tt := range tests {
+		got, err := jsonPathValue(body, tt.path)
+		if err != nil {
+			t.Errorf("jsonPathValue(%q): %v", tt.path, err)
+			continue
+		}
+		if got != tt.value {
+			t.Errorf("jsonPathValue(%q) = %s, want %s", tt.path, got, tt.value)
+		}
+	}
+}
+
+func TestJSONPathValueInvalid(t *testing.T) {
+	body := []byte(`{"token": "abc", "data": {"items": [{"id": 7}]}}`)
+
+	tests := []struct {
+		body []byte
+		path string
+	}{
+		{body, "missing"},
+		{body, "data.missing.id"},
+		{body, "data.items.1.id"},
+		{body, "data.items.-1.id"},
+		{body, "data.items.first.id"},
+		{body, "token.length"},
+		{[]byte("<html>not json</html>"), "token"},
+		{[]byte(""), "token"},
+		{[]byte(`{"token": "abc"} trailing`), "token"},
+	}
+	for _, tt := range tests {
+		if got, err := jsonPathValue(tt.body, tt.path); err == nil {
+			t.Errorf("jsonPathValue(%s, %q) = %s, want an error", tt.body, tt.path, got)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Location": {"/items/7"}}}
+	body := []byte(`{"token": "abc"} session=s3cr3t;`)
+	jsonBody := []byte(`{"token": "abc"}`)
+
+	tests := []struct {
+		name  string
+		spec  kafka.Extraction
+		body  []byte
+		value string
+		fails bool
+	}{
+		{"json", kafka.Extraction{From: "json", Expression: "token"}, jsonBody, "abc", false},
+		{"json from non-JSON body", kafka.Extraction{From: "json", Expression: "token"}, body, "", true},
+		{"header", kafka.Extraction{From: "header", Expression: "location"}, nil, "/items/7", false},
+		{"missing header", kafka.Extraction{From: "header", Expression: "X-Token"}, nil, "", true},
+		{"regex group", kafka.Extraction{From: "regex", Expression: `session=(\w+)`}, body, "s3cr3t", false},
+		{"regex match", kafka.Extraction{From: "regex", Expression: `s\d+cr`}, body, "s3cr", false},
+		{"regex miss", kafka.Extraction{From: "regex", Expression: `user=(\w+)`}, body, "", true},
+	}
+	for _, tt := range tests {
+		var regex *regexp.Regexp
+		if tt.spec.From == "regex" {
+			regex = regexp.MustCompile(tt.spec.Expression)
+		}
+		tt.spec.Name = tt.name
+		e, err := newExtractor(tt.spec, regex)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		got, err := e.extract(resp, tt.body)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%s: extracted %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.value {
+			t.Errorf("%s: extracted %q, %v, want %q", tt.name, got, err, tt.value)
+		}
+	}
+}
+
+func TestNewExtractorUnknownSource(t *testing.T) {
+	if _, err := newExtractor(kafka.Extraction{Name: "x", From: "cookie", Expression: "session"}, nil); err == nil {
+		t.Error("want an error for an unknown source")
+	}
+}
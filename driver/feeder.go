@@ -0,0 +1,77 @@
+package driver
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// feeder hands out data feed rows to iterations.
+type feeder struct {
+	rows      []map[string]string
+	indexes   []int // rows this driver may use, in order
+	random    bool
+	unique    bool
+	next      int64
+	wrapped   sync.Once
+	exhausted chan struct{} // closed once a unique feed runs out of rows
+	logger    *log.Logger
+}
+
+// newFeeder parses feed and selects the rows nodeID may use.
+func newFeeder(feed *kafka.DataFeed, nodeID string, logger *log.Logger) (*feeder, error) {
+	rows, err := feed.Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &feeder{rows: rows, random: feed.Mode == "random", unique: feed.Mode == "unique", exhausted: make(chan struct{}), logger: logger}
+	if feed.Mode == "unique" {
+		for _, i := range feed.Partitions[nodeID] {
+			if i >= 0 && i < len(rows) {
+				f.indexes = append(f.indexes, i)
+			}
+		}
+	} else {
+		f.indexes = make([]int, len(rows))
+		for i := range rows {
+			f.indexes[i] = i
+		}
+	}
+
+	if len(f.indexes) == 0 {
+		logger.Println("No data feed rows assigned to this driver")
+	}
+	return f, nil
+}
+
+// row returns the variables for the next iteration. Once a sequential feed
+// runs out of rows it starts over from its first row. A unique feed never
+// hands out a row twice: once it runs out, row returns false and closes
+// f.exhausted.
+func (f *feeder) row() (map[string]string, bool) {
+	if len(f.indexes) == 0 && !f.unique {
+		return nil, true
+	}
+	if f.random {
+		return f.rows[f.indexes[rand.Intn(len(f.indexes))]], true
+	}
+
+	n := atomic.AddInt64(&f.next, 1) - 1
+	if n >= int64(len(f.indexes)) && f.unique {
+		f.wrapped.Do(func() {
+			f.logger.Println("Data feed rows exhausted, stopping the test")
+			close(f.exhausted)
+		})
+		return nil, false
+	}
+	if n == int64(len(f.indexes)) {
+		f.wrapped.Do(func() {
+			f.logger.Println("Data feed rows exhausted, starting over from the first row")
+		})
+	}
+	return f.rows[f.indexes[n%int64(len(f.indexes))]], true
+}
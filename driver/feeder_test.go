@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+func TestFeederUniqueStopsWhenRowsRunOut(t *testing.T) {
+	feed := &kafka.DataFeed{
+		Format:     "csv",
+		Data:       "id\n1\n2\n3\n",
+		Mode:       "unique",
+		Partitions: map[string][]int{"node": {0, 2}},
+	}
+	f, err := newFeeder(feed, "node", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"1", "3"} {
+		row, ok := f.row()
+		if !ok || row["id"] != want {
+			t.Fatalf("row() = %v, %v, want id %s", row, ok, want)
+		}
+	}
+	select {
+	case <-f.exhausted:
+		t.Fatal("exhausted before the rows ran out")
+	default:
+	}
+
+	if row, ok := f.row(); ok {
+		t.Fatalf("row() = %v after the rows ran out, want none", row)
+	}
+	select {
+	case <-f.exhausted:
+	default:
+		t.Fatal("not exhausted after the rows ran out")
+	}
+}
+
+func TestFeederSequentialWraps(t *testing.T) {
+	feed := &kafka.DataFeed{Format: "csv", Data: "id\n1\n2\n", Mode: "sequential"}
+	f, err := newFeeder(feed, "node", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"1", "2", "1"} {
+		row, ok := f.row()
+		if !ok || row["id"] != want {
+			t.Fatalf("row() = %v, %v, want id %s", row, ok, want)
+		}
+	}
+}
@@ -1,15 +1,12 @@
 package driver
 
 import (
-  "github.com/dgraph-io/badger/v3"
   "github.com/ankush-003/distributed-load-testing/kafka"
   "log"
-  "sort"
 	//"os"
 	//"os/signal"
-	//"sync"
+	"sync"
 	"time"
-  "github.com/google/uuid"	
   "fmt"
 )
 
@@ -24,168 +21,458 @@ type DriverNode struct {
 }
 
 type MetricsStore struct {
-	Db *badger.DB
+	mu        sync.Mutex
+	stage     string                        // stage currently being executed, empty outside staged tests
+	stages    []string                      // stages seen so far, in execution order
+	endpoints []string                      // endpoints seen so far, in order of first request
+	checks    map[string]*kafka.CheckResult // pass and fail counts per check in the current window
+	scopes    map[string]*scopeMetrics      // metrics per scope in the current window: "" for all requests, "stage:<name>" or "endpoint:<name>"
+	started   time.Time                     // when the test started, zero before
+	window    time.Time                     // when the current window started
+	sequence  int64                         // number of windows reported so far
+	targetRPS float64                       // request rate the test currently aims for, 0 if it has none
+	paused    bool                          // whether the test is paused
+	wasPaused bool                          // whether the test was paused during the current window
 }
 
-func NewMetricsStore() (*MetricsStore, error) {
-	opts := badger.DefaultOptions("").WithInMemory(true) // You can adjust BadgerDB options here
-	db, err := badger.Open(opts)
-	if err != nil {
-		return nil, err
-	}
-	return &MetricsStore{Db: db}, nil
+// defaultMetricsInterval is the length of the windows metrics are reported
+// for when the test does not set one.
+const defaultMetricsInterval = time.Second
+
+// scopeMetrics is what has been recorded about the requests of one scope.
+type scopeMetrics struct {
+	latencies     kafka.Histogram
+	phases        map[string]*kafka.Histogram // latencies per request phase
+	requests      int64
+	errors        int64
+	bytesSent     int64
+	bytesReceived int64
+	statusCodes   map[int]int64
+	errorClasses  map[string]int64
+	canceled      int64
 }
 
-func (m *MetricsStore) StoreLatency(requestIndex int, latency time.Duration) error {
-	key := []byte(fmt.Sprintf("request-%d", requestIndex))
+func NewMetricsStore() *MetricsStore {
+	return &MetricsStore{}
+}
 
-	err := m.Db.Update(func(txn *badger.Txn) error {
-		err := txn.Set(key, []byte(latency.String()))
-		return err
+// StoreLatency records the latency of a request sent during stage to
+// endpoint.
+func (m *MetricsStore) StoreLatency(stage string, endpoint string, latency time.Duration) {
+	m.record(stage, endpoint, func(s *scopeMetrics) {
+		s.latencies.Record(latency)
 	})
-	return err
 }
 
-func (m *MetricsStore) GetLatency(requestIndex int) (time.Duration, error) {
-	key := []byte(fmt.Sprintf("request-%d", requestIndex))
-	var latency time.Duration
+// StorePhases records how long each phase of a request sent during stage to
+// endpoint took.
+func (m *MetricsStore) StorePhases(stage string, endpoint string, phases map[string]time.Duration) {
+	m.record(stage, endpoint, func(s *scopeMetrics) {
+		if s.phases == nil {
+			s.phases = make(map[string]*kafka.Histogram)
+		}
+		for phase, d := range phases {
+			h, ok := s.phases[phase]
+			if !ok {
+				h = &kafka.Histogram{}
+				s.phases[phase] = h
+			}
+			h.Record(d)
+		}
+	})
+}
+
+// StoreBytes records the size of a request sent during stage to endpoint
+// and of its response.
+func (m *MetricsStore) StoreBytes(stage string, endpoint string, sent int64, received int64) {
+	m.record(stage, endpoint, func(s *scopeMetrics) {
+		s.bytesSent += sent
+		s.bytesReceived += received
+	})
+}
 
-	err := m.Db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
+// StoreStatus counts a response with status to a request sent during stage
+// to endpoint. 4xx and 5xx responses count as errors.
+func (m *MetricsStore) StoreStatus(stage string, endpoint string, status int) {
+	m.record(stage, endpoint, func(s *scopeMetrics) {
+		if s.statusCodes == nil {
+			s.statusCodes = make(map[int]int64)
+		}
+		s.statusCodes[status]++
+		s.requests++
+		if status >= 400 {
+			s.errors++
 		}
+	})
+}
 
-		err = item.Value(func(val []byte) error {
-			latency, err = time.ParseDuration(string(val))
-			return err
-		})
-		return err
+// StoreError counts a request sent during stage to endpoint that failed
+// with err before getting a response. Requests cancelled because the test
+// ended are counted apart, they say nothing about the server.
+func (m *MetricsStore) StoreError(stage string, endpoint string, err error) {
+	class := classifyError(err)
+	m.record(stage, endpoint, func(s *scopeMetrics) {
+		if class == "canceled" {
+			s.canceled++
+			return
+		}
+		if s.errorClasses == nil {
+			s.errorClasses = make(map[string]int64)
+		}
+		s.errorClasses[class]++
+		s.requests++
+		s.errors++
 	})
+}
 
-	if err != nil {
-		return 0, err
+// record applies update to the metrics of every scope a request sent during
+// stage to endpoint belongs to.
+func (m *MetricsStore) record(stage string, endpoint string, update func(s *scopeMetrics)) {
+	if endpoint != "" {
+		m.addEndpoint(endpoint)
 	}
 
-	return latency, nil
-}
+	scopes := []string{""}
+	if stage != "" {
+		scopes = append(scopes, "stage:"+stage)
+	}
+	if endpoint != "" {
+		scopes = append(scopes, "endpoint:"+endpoint)
+	}
 
-func getMetrics(latencies []time.Duration) (string, string, string, string) {
-	if len(latencies) == 0 {
-		return "", "", "", ""
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.scopes == nil {
+		m.scopes = make(map[string]*scopeMetrics)
+	}
+	for _, scope := range scopes {
+		s, ok := m.scopes[scope]
+		if !ok {
+			s = &scopeMetrics{}
+			m.scopes[scope] = s
+		}
+		update(s)
 	}
+}
 
-	// Sort the latencies
-	sort.Slice(latencies, func(i, j int) bool {
-		return latencies[i] < latencies[j]
-	})
+// addEndpoint remembers endpoint so its metrics are reported.
+func (m *MetricsStore) addEndpoint(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Calculate mean
-	var sum time.Duration
-	for _, latency := range latencies {
-		sum += latency
+	for _, e := range m.endpoints {
+		if e == endpoint {
+			return
+		}
 	}
-	mean := time.Duration(int(sum) / len(latencies))
+	m.endpoints = append(m.endpoints, endpoint)
+}
+
+// Endpoints returns the endpoints requests have been recorded for.
+func (m *MetricsStore) Endpoints() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.endpoints...)
+}
 
-	// Calculate median
-	var median time.Duration
-	if len(latencies)%2 == 0 {
-		median = (latencies[len(latencies)/2-1] + latencies[len(latencies)/2]) / 2
+// RecordCheck counts a pass or fail of the check named name.
+func (m *MetricsStore) RecordCheck(name string, passed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.checks == nil {
+		m.checks = make(map[string]*kafka.CheckResult)
+	}
+	result, ok := m.checks[name]
+	if !ok {
+		result = &kafka.CheckResult{}
+		m.checks[name] = result
+	}
+	if passed {
+		result.Passes++
 	} else {
-		median = latencies[len(latencies)/2]
+		result.Fails++
 	}
+}
+
+// StartTest marks the start of the test and of its first metrics window,
+// discarding everything recorded for the previous test.
+func (m *MetricsStore) StartTest() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stage = ""
+	m.stages = nil
+	m.endpoints = nil
+	m.started = time.Now()
+	m.window = m.started
+	m.sequence = 0
+	m.scopes = nil
+	m.checks = nil
+	m.targetRPS = 0
+	m.paused = false
+	m.wasPaused = false
+}
+
+// SetPaused marks the test as paused or running.
+func (m *MetricsStore) SetPaused(paused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.paused = paused
+	m.wasPaused = m.wasPaused || paused
+}
+
+// SetTargetRPS sets the request rate the test currently aims for.
+func (m *MetricsStore) SetTargetRPS(rps float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.targetRPS = rps
+}
+
+// TargetRPS returns the request rate the test currently aims for.
+func (m *MetricsStore) TargetRPS() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.targetRPS
+}
 
-	// Calculate min and max
-	min := latencies[0]
-	max := latencies[len(latencies)-1]
+// Started returns when the test started, the zero time before it has.
+func (m *MetricsStore) Started() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Format results as strings
-	return mean.String(), median.String(), min.String(), max.String()
+	return m.started
 }
 
-func (m *MetricsStore) CalculateMetrics(logger *log.Logger) (string, string, string, string) {
-	var latencies []time.Duration
+// metricsWindow is what was recorded during one metrics window.
+type metricsWindow struct {
+	start    time.Time
+	end      time.Time
+	sequence int64
+	paused   bool
+	scopes   map[string]*scopeMetrics
+	checks   map[string]*kafka.CheckResult
+}
+
+// takeWindow ends the current metrics window at end, returning what was
+// recorded during it, and starts the next one.
+func (m *MetricsStore) takeWindow(end time.Time) metricsWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.window.IsZero() {
+		m.window = end
+	}
+	m.sequence++
+	w := metricsWindow{
+		start:    m.window,
+		end:      end,
+		sequence: m.sequence,
+		paused:   m.wasPaused,
+		scopes:   m.scopes,
+		checks:   m.checks,
+	}
+	m.window = end
+	m.wasPaused = m.paused
+	m.scopes = nil
+	m.checks = nil
+	return w
+}
 
-	err := m.Db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
-		it := txn.NewIterator(opts)
-		defer it.Close()
+// SetStage marks stage as the one currently being executed.
+func (m *MetricsStore) SetStage(stage string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			valCopy, err := item.ValueCopy(nil)
-			if err != nil {
-				return err
+	m.stage = stage
+	for _, s := range m.stages {
+		if s == stage {
+			return
+		}
+	}
+	m.stages = append(m.stages, stage)
+}
+
+// Stage returns the active stage and all stages seen so far.
+func (m *MetricsStore) Stage() (string, []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stage, append([]string(nil), m.stages...)
+}
+
+// CalculateMetrics summarises the requests recorded in the current window.
+func (m *MetricsStore) CalculateMetrics() kafka.MetricsData {
+	return m.calculateScopeMetrics("")
+}
+
+// CalculateStageMetrics summarises the requests sent during stage in the
+// current window.
+func (m *MetricsStore) CalculateStageMetrics(stage string) kafka.MetricsData {
+	return m.calculateScopeMetrics("stage:" + stage)
+}
+
+// CalculateEndpointMetrics summarises the requests sent to endpoint in the
+// current window.
+func (m *MetricsStore) CalculateEndpointMetrics(endpoint string) kafka.MetricsData {
+	return m.calculateScopeMetrics("endpoint:" + endpoint)
+}
+
+func (m *MetricsStore) calculateScopeMetrics(scope string) kafka.MetricsData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.scopes[scope]
+	if !ok {
+		return kafka.MetricsData{}
+	}
+	return s.metricsData()
+}
+
+// metricsData summarises s. The MetricsData does not share anything with
+// s, which may keep changing.
+func (s *scopeMetrics) metricsData() kafka.MetricsData {
+	latencies := &kafka.Histogram{}
+	latencies.Merge(&s.latencies)
+
+	data := kafka.NewMetricsData(latencies)
+	for phase, h := range s.phases {
+		if data.Phases == nil {
+			data.Phases = make(map[string]kafka.MetricsData, len(s.phases))
+		}
+		phaseLatencies := &kafka.Histogram{}
+		phaseLatencies.Merge(h)
+		data.Phases[phase] = kafka.NewMetricsData(phaseLatencies)
+	}
+	data.Requests = s.requests
+	data.BytesSent = s.bytesSent
+	data.BytesReceived = s.bytesReceived
+	data.Errors = s.errors
+	data.Canceled = s.canceled
+	if len(s.statusCodes) > 0 {
+		data.StatusCodes = make(map[int]int64, len(s.statusCodes))
+		for status, count := range s.statusCodes {
+			data.StatusCodes[status] = count
+		}
+	}
+	if len(s.errorClasses) > 0 {
+		data.ErrorClasses = make(map[string]int64, len(s.errorClasses))
+		for class, count := range s.errorClasses {
+			data.ErrorClasses[class] = count
+		}
+	}
+	return data
+}
+
+// buildMetricsMessage ends the current metrics window and wraps the metrics
+// recorded during it in a MetricsMessage for driverNode. final marks the
+// last window of the test.
+func (m *MetricsStore) buildMetricsMessage(driverNode *DriverNode, final bool, logger *log.Logger) kafka.MetricsMessage {
+	w := m.takeWindow(time.Now())
+
+	metricsMsg := kafka.MetricsMessage{
+		Version:       kafka.MetricsVersion,
+		NodeID:        driverNode.NodeID,
+		TestID:        driverNode.TestID,
+		ReportID:      fmt.Sprintf("%s-%d", driverNode.NodeID, w.sequence),
+		Sequence:      w.sequence,
+		Final:         final,
+		Paused:        w.paused,
+		WindowStartMs: w.start.UnixMilli(),
+		WindowEndMs:   w.end.UnixMilli(),
+	}
+	if started := m.Started(); !started.IsZero() {
+		metricsMsg.ElapsedSeconds = w.end.Sub(started).Seconds()
+	}
+	if s, ok := w.scopes[""]; ok {
+		metricsMsg.Metrics = s.metricsData()
+	}
+	if window := w.end.Sub(w.start); window > 0 {
+		metricsMsg.RPS = float64(metricsMsg.Metrics.Requests) / window.Seconds()
+	}
+	metricsMsg.TargetRPS = m.TargetRPS()
+
+	// Tag the report with the active stage and break metrics down per stage
+	activeStage, stages := m.Stage()
+	metricsMsg.Stage = activeStage
+	for _, stage := range stages {
+		if s, ok := w.scopes["stage:"+stage]; ok {
+			if metricsMsg.StageMetrics == nil {
+				metricsMsg.StageMetrics = make(map[string]kafka.MetricsData)
 			}
-			latency, err := time.ParseDuration(string(valCopy))
-			if err != nil {
-				return err
+			metricsMsg.StageMetrics[stage] = s.metricsData()
+		}
+	}
+
+	// Break metrics down per endpoint of a multi-endpoint scenario
+	for _, endpoint := range m.Endpoints() {
+		if s, ok := w.scopes["endpoint:"+endpoint]; ok {
+			if metricsMsg.EndpointMetrics == nil {
+				metricsMsg.EndpointMetrics = make(map[string]kafka.MetricsData)
 			}
-			latencies = append(latencies, latency)
+			metricsMsg.EndpointMetrics[endpoint] = s.metricsData()
 		}
-		return nil
-	})
+	}
 
-	if err != nil {
-		logger.Println("Error fetching latencies:", err)
-		return "", "", "", ""
+	if len(w.checks) > 0 {
+		metricsMsg.Checks = make(map[string]kafka.CheckResult, len(w.checks))
+		for name, result := range w.checks {
+			metricsMsg.Checks[name] = *result
+		}
 	}
 
-	return getMetrics(latencies)
+	return metricsMsg
 }
 
-func (m *MetricsStore) ProduceMetricsToTopic(done <-chan struct{}, producer *kafka.Producer, topic string, driverNode *DriverNode, logger *log.Logger) {
-	ticker := time.NewTicker(10 * time.Millisecond) // Adjust the interval for sending metrics
-	defer ticker.Stop()
+// ProduceMetricsToTopic produces the metrics of each interval long window
+// until done is closed. Windows end on multiples of interval so that windows
+// of different nodes line up.
+func (m *MetricsStore) ProduceMetricsToTopic(done <-chan struct{}, producer *kafka.Producer, topic string, driverNode *DriverNode, interval time.Duration, logger *log.Logger) {
+	if interval <= 0 {
+		interval = defaultMetricsInterval
+	}
+	next := time.Now().Truncate(interval).Add(interval)
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			meanLatency, medianLatency, minLatency, maxLatency := m.CalculateMetrics(logger)
-
-			// Create MetricsData object
-			metricsData := kafka.MetricsData{
-				MeanLatency:   meanLatency,
-				MedianLatency: medianLatency,
-				MinLatency:    minLatency,
-				MaxLatency:    maxLatency,
-			}
-
+		case <-timer.C:
 			// Produce metrics message to Kafka
-			metricsMsg := kafka.MetricsMessage{
-				NodeID:  driverNode.NodeID,
-				TestID:  driverNode.TestID,
-				ReportID: uuid.New().String(),
-				Metrics: metricsData,
-			}
+			metricsMsg := m.buildMetricsMessage(driverNode, false, logger)
 			producer.ProduceMetricsMessages(topic, []kafka.MetricsMessage{metricsMsg})
-      logger.Println("Metrics Produced:", metricsMsg)
+			logger.Println("Metrics Produced:", metricsMsg)
+
+			next = next.Add(interval)
+			timer.Reset(time.Until(next))
 		case <-done:
 			return // Stop producing metrics when done signal is received
 		}
 	}
 }
 
-func (m *MetricsStore) ProduceMetricsToTopicOnce(producer *kafka.Producer, topic string, driverNode *DriverNode, logger *log.Logger) {
-	meanLatency, medianLatency, minLatency, maxLatency := m.CalculateMetrics(logger)
-
-	// Create MetricsData object
-	metricsData := kafka.MetricsData{
-		MeanLatency:   meanLatency,
-		MedianLatency: medianLatency,
-		MinLatency:    minLatency,
-		MaxLatency:    maxLatency,
-	}
+// AcknowledgeTest produces an empty first window as soon as the test starts,
+// so that the orchestrator waits for this driver to finish it even if other
+// drivers finish before this one reports any requests.
+func (m *MetricsStore) AcknowledgeTest(producer *kafka.Producer, topic string, driverNode *DriverNode, logger *log.Logger) {
+	metricsMsg := m.buildMetricsMessage(driverNode, false, logger)
+	producer.ProduceMetricsMessages(topic, []kafka.MetricsMessage{metricsMsg})
+	logger.Println("Test Acknowledged:", metricsMsg)
+}
 
+// ProduceMetricsToTopicOnce produces the metrics of the last window of the
+// test, with testErr if the driver could not run it.
+func (m *MetricsStore) ProduceMetricsToTopicOnce(producer *kafka.Producer, topic string, driverNode *DriverNode, testErr error, logger *log.Logger) {
 	// Produce metrics message to Kafka
-	metricsMsg := kafka.MetricsMessage{
-		NodeID:   driverNode.NodeID,
-		TestID:   driverNode.TestID,
-		ReportID: uuid.New().String(),
-		Metrics:  metricsData,
+	metricsMsg := m.buildMetricsMessage(driverNode, true, logger)
+	if testErr != nil {
+		metricsMsg.Error = testErr.Error()
 	}
-
 	producer.ProduceMetricsMessages(topic, []kafka.MetricsMessage{metricsMsg})
 	logger.Println("Metrics Produced:", metricsMsg)
-}
\ No newline at end of file
+}
@@ -0,0 +1,77 @@
+package driver
+
+import (
+	"sync"
+	"time"
+)
+
+// PauseGate suspends request generation while a test is paused. Executors
+// wait at the gate before sending and measure their progress in active time,
+// so a paused test resumes at the stage position and rate it was paused at.
+type PauseGate struct {
+	mu        sync.Mutex
+	created   time.Time
+	resumed   chan struct{} // closed on resume, nil while running
+	pausedAt  time.Time
+	pausedFor time.Duration // time spent paused before pausedAt
+}
+
+func NewPauseGate() *PauseGate {
+	return &PauseGate{created: time.Now()}
+}
+
+// pause closes the gate. It returns false if the gate was already closed.
+func (g *PauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	g.pausedAt = time.Now()
+	return true
+}
+
+// resume opens the gate. It returns false if the gate was not closed.
+func (g *PauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	g.pausedFor += time.Since(g.pausedAt)
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+// wait blocks while the gate is closed. It returns how long it blocked, and
+// false if stop was closed first.
+func (g *PauseGate) wait(stop <-chan struct{}) (time.Duration, bool) {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return 0, true
+	}
+
+	start := time.Now()
+	select {
+	case <-resumed:
+		return time.Since(start), true
+	case <-stop:
+		return time.Since(start), false
+	}
+}
+
+// active returns the time the gate has been open since it was created.
+// Differences between two calls measure elapsed time excluding pauses.
+func (g *PauseGate) active() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	paused := g.pausedFor
+	if g.resumed != nil {
+		paused += time.Since(g.pausedAt)
+	}
+	return time.Since(g.created) - paused
+}
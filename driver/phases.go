@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of an HTTP request reported in kafka.MetricsData.Phases. DNS,
+// connect and TLS only happen on requests that open a new connection. TTFB
+// is the time from the request being written to the first response byte,
+// the time the server spent on it, and transfer the time from there to the
+// end of the body.
+const (
+	phaseDNS      = "dns"
+	phaseConnect  = "connect"
+	phaseTLS      = "tls"
+	phaseTTFB     = "ttfb"
+	phaseTransfer = "transfer"
+)
+
+// phaseTimer records when the phases of a request start and end. Its trace
+// callbacks may be called from the goroutines dialing the connection.
+type phaseTimer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// trace returns the httptrace.ClientTrace that feeds the timer.
+func (p *phaseTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { p.mark(&p.dnsDone) },
+		ConnectStart: func(string, string) {
+			// Dialing several addresses at once counts from the first attempt
+			p.mu.Lock()
+			if p.connectStart.IsZero() {
+				p.connectStart = time.Now()
+			}
+			p.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.mark(&p.connectDone)
+			}
+		},
+		TLSHandshakeStart:    func() { p.mark(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.mark(&p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.mark(&p.wroteRequest) },
+		GotFirstResponseByte: func() { p.mark(&p.firstByte) },
+	}
+}
+
+func (p *phaseTimer) mark(t *time.Time) {
+	p.mu.Lock()
+	*t = time.Now()
+	p.mu.Unlock()
+}
+
+// phases returns how long each phase of the request took, given that its
+// body was read by end. Phases that did not happen are left out.
+func (p *phaseTimer) phases(end time.Time) map[string]time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	phases := make(map[string]time.Duration, 5)
+	add := func(phase string, start time.Time, done time.Time) {
+		if !start.IsZero() && !done.IsZero() && !done.Before(start) {
+			phases[phase] = done.Sub(start)
+		}
+	}
+	add(phaseDNS, p.dnsStart, p.dnsDone)
+	add(phaseConnect, p.connectStart, p.connectDone)
+	add(phaseTLS, p.tlsStart, p.tlsDone)
+	add(phaseTTFB, p.wroteRequest, p.firstByte)
+	add(phaseTransfer, p.firstByte, end)
+	return phases
+}
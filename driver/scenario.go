@@ -0,0 +1,288 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// Scenario is the traffic a driver sends during a test. Executors decide when
+// to send, the scenario decides what: either one request picked by weight, or
+// a journey of steps run in order.
+type Scenario struct {
+	requests []*preparedRequest
+	weights  []int // cumulative weights of requests, used to pick one
+	named    bool  // whether metrics are broken down per request name
+	steps    []*preparedRequest
+	feeder   *feeder // data feed rows for iterations, nil without a data feed
+}
+
+// preparedRequest is a request spec resolved once per test so that sending
+// it only has to substitute variables.
+type preparedRequest struct {
+	name    string
+	method  string
+	url     kafka.ValueTemplate
+	query   map[string]kafka.ValueTemplate
+	headers map[string]kafka.ValueTemplate
+	host    kafka.ValueTemplate
+	body    kafka.ValueTemplate
+	binary  []byte // decoded body_base64, sent as is
+	extract []extractor
+	checks  []checker
+}
+
+// readsBody reports whether the response body is needed to extract values or
+// run checks.
+func (r *preparedRequest) readsBody() bool {
+	if len(r.extract) > 0 {
+		return true
+	}
+	for _, c := range r.checks {
+		if c.needsBody() {
+			return true
+		}
+	}
+	return false
+}
+
+// NewScenario builds the scenario described by testConfig for driverNode.
+// Requests without a URL are sent to the driver's test server.
+func NewScenario(testConfig *kafka.TestConfigMessage, driverNode *DriverNode, logger *log.Logger) (*Scenario, error) {
+	scenario, err := newRequestScenario(testConfig, driverNode.TestServer, kafka.TemplateFuncs(driverNode.NodeID))
+	if err != nil {
+		return nil, err
+	}
+
+	if testConfig.DataFeed != nil {
+		if scenario.feeder, err = newFeeder(testConfig.DataFeed, driverNode.NodeID, logger); err != nil {
+			return nil, err
+		}
+	}
+	return scenario, nil
+}
+
+// newRequestScenario prepares the journey steps or requests of testConfig,
+// with funcs available to their templates.
+func newRequestScenario(testConfig *kafka.TestConfigMessage, testServer string, funcs template.FuncMap) (*Scenario, error) {
+	if len(testConfig.Steps) > 0 {
+		scenario := &Scenario{}
+		for _, spec := range testConfig.Steps {
+			step, err := prepareRequest(spec, testServer, funcs)
+			if err != nil {
+				return nil, err
+			}
+			scenario.steps = append(scenario.steps, step)
+		}
+		return scenario, nil
+	}
+
+	specs := testConfig.Requests
+	named := len(specs) > 0
+	if !named {
+		spec := kafka.RequestSpec{}
+		if testConfig.Request != nil {
+			spec = *testConfig.Request
+		}
+		specs = []kafka.RequestSpec{spec}
+	}
+
+	scenario := &Scenario{named: named}
+	total := 0
+	for _, spec := range specs {
+		request, err := prepareRequest(spec, testServer, funcs)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := spec.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		total += weight
+
+		scenario.requests = append(scenario.requests, request)
+		scenario.weights = append(scenario.weights, total)
+	}
+	return scenario, nil
+}
+
+// pick chooses the next request to send, weighted by the request weights.
+func (s *Scenario) pick() *preparedRequest {
+	if len(s.requests) == 1 {
+		return s.requests[0]
+	}
+	n := rand.Intn(s.weights[len(s.weights)-1])
+	i := sort.SearchInts(s.weights, n+1)
+	return s.requests[i]
+}
+
+// row returns the data feed row for the next iteration, or nil without a
+// data feed. The row is shared and must not be modified. It returns false
+// once a unique data feed has run out of rows.
+func (s *Scenario) row() (map[string]string, bool) {
+	if s.feeder == nil {
+		return nil, true
+	}
+	return s.feeder.row()
+}
+
+// Exhausted returns a channel closed once a unique data feed has run out of
+// rows, after which no more iterations can run.
+func (s *Scenario) Exhausted() <-chan struct{} {
+	if s.feeder == nil || !s.feeder.unique {
+		return nil
+	}
+	return s.feeder.exhausted
+}
+
+// endpoint returns the name metrics for request are recorded under, or an
+// empty string when the scenario has no per-request breakdown.
+func (s *Scenario) endpoint(request *preparedRequest) string {
+	if !s.named {
+		return ""
+	}
+	return request.name
+}
+
+// runJourney runs the scenario's steps in order for one iteration, passing
+// the iteration's data feed row and the values extracted from each response
+// on to the following steps. The journey stops at the first step that fails.
+// Only the first step is timed from intendedStart, later steps go out as soon
+// as the previous one is done.
+func (s *Scenario) runJourney(ctx context.Context, iteration int, stage string, intendedStart time.Time, metricsStore *MetricsStore, logger *log.Logger) {
+	row, ok := s.row()
+	if !ok {
+		return
+	}
+	vars := make(map[string]string)
+	for k, v := range row {
+		vars[k] = v
+	}
+
+	for i, step := range s.steps {
+		requestNumber := iteration*len(s.steps) + i
+		resp, body, err := sendRequest(ctx, step, vars, requestNumber, stage, step.name, intendedStart, metricsStore, logger)
+		if err != nil {
+			logger.Printf("Journey %d stopped at step %s: %s\n", iteration, step.name, err)
+			return
+		}
+
+		for _, e := range step.extract {
+			value, err := e.extract(resp, body)
+			if err != nil {
+				logger.Printf("Journey %d stopped at step %s: %s\n", iteration, step.name, err)
+				return
+			}
+			vars[e.name] = value
+		}
+		intendedStart = time.Now()
+	}
+}
+
+// prepareRequest resolves spec into a preparedRequest, defaulting to a GET
+// of testServer. Its templates can call funcs.
+func prepareRequest(spec kafka.RequestSpec, testServer string, funcs template.FuncMap) (*preparedRequest, error) {
+	parsed, err := kafka.ParseRequestSpec(spec, testServer, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	rawURL := parsed.URL.Raw()
+	name := spec.Name
+	if name == "" {
+		name = parsed.Method + " " + rawURL
+		if u, err := url.Parse(rawURL); err == nil {
+			name = parsed.Method + " " + u.Path
+		}
+	}
+
+	request := &preparedRequest{
+		name:    name,
+		method:  parsed.Method,
+		url:     parsed.URL,
+		query:   parsed.Query,
+		headers: parsed.Headers,
+		host:    parsed.Host,
+		body:    parsed.Body,
+		binary:  parsed.Binary,
+	}
+	for i, e := range spec.Extract {
+		extractor, err := newExtractor(e, parsed.ExtractRegexps[i])
+		if err != nil {
+			return nil, err
+		}
+		request.extract = append(request.extract, extractor)
+	}
+	for i, c := range spec.Checks {
+		checker, err := newChecker(c, name, parsed.CheckRegexps[i])
+		if err != nil {
+			return nil, err
+		}
+		request.checks = append(request.checks, checker)
+	}
+	return request, nil
+}
+
+// newHTTPRequest builds the http.Request to send for r with vars and
+// requestNumber substituted.
+func (r *preparedRequest) newHTTPRequest(vars map[string]string, requestNumber int) (*http.Request, error) {
+	rawURL, err := r.url.Render(vars, requestNumber)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.query) > 0 {
+		query := u.Query()
+		for k, tmpl := range r.query {
+			v, err := tmpl.Render(vars, requestNumber)
+			if err != nil {
+				return nil, err
+			}
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	var body io.Reader
+	if len(r.binary) > 0 {
+		body = bytes.NewReader(r.binary)
+	} else if r.body.Raw() != "" {
+		rendered, err := r.body.Render(vars, requestNumber)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	req, err := http.NewRequest(r.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, tmpl := range r.headers {
+		v, err := tmpl.Render(vars, requestNumber)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+	if r.host.Raw() != "" {
+		if req.Host, err = r.host.Render(vars, requestNumber); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
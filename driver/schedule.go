@@ -0,0 +1,245 @@
+package driver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// rampIdleStep is the longest rateExecutor.run waits before re-evaluating the
+// rate.
+const rampIdleStep = 10 * time.Millisecond
+
+// rampRate returns the request rate a ramp should be running at after
+// elapsed time, interpolating linearly from startRPS to targetRPS.
+func rampRate(startRPS, targetRPS float64, rampDuration, elapsed time.Duration) float64 {
+	if rampDuration <= 0 || elapsed >= rampDuration {
+		return targetRPS
+	}
+	progress := float64(elapsed) / float64(rampDuration)
+	return startRPS + (targetRPS-startRPS)*progress
+}
+
+// rateExecutor sends requests on a schedule derived from a request rate. It
+// follows an open model: requests are launched when they are due regardless
+// of how many earlier requests are still waiting for a response, and their
+// latency is measured from the time they were due, so a stalled target shows
+// up in the latencies instead of silently slowing the schedule down.
+type rateExecutor struct {
+	ctx            context.Context // cancelled to abandon in-flight requests
+	scenario       *Scenario
+	metricsStore   *MetricsStore
+	inFlight       chan struct{} // caps the number of in-flight requests, nil for no cap
+	arrivals       arrivalProcess
+	pause          *PauseGate
+	requestCounter int64
+	wg             sync.WaitGroup
+	logger         *log.Logger
+}
+
+func newRateExecutor(ctx context.Context, scenario *Scenario, metricsStore *MetricsStore, maxInFlight int, arrival *kafka.ArrivalDistribution, pause *PauseGate, logger *log.Logger) *rateExecutor {
+	e := &rateExecutor{ctx: ctx, scenario: scenario, metricsStore: metricsStore, arrivals: newArrivalProcess(arrival), pause: pause, logger: logger}
+	if maxInFlight > 0 {
+		e.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return e
+}
+
+// run sends requests at the rate rateAt returns for the time elapsed so far,
+// tagging them with stage. It stops once duration has elapsed or maxRequests
+// requests have been sent; a zero value disables either limit. Time spent
+// paused does not count as elapsed. It returns false if stop was closed
+// first.
+//
+// Gaps between requests are drawn at one request per second and a request is
+// due once the rate, integrated over time, covers its gap. The rate is
+// re-evaluated at least every rampIdleStep, so a ramp starting from zero
+// speeds up between two requests instead of waiting out the gap of its first,
+// near zero, rate.
+func (e *rateExecutor) run(stage string, rateAt func(elapsed time.Duration) float64, duration time.Duration, maxRequests int, stop <-chan struct{}) bool {
+	start := e.pause.active()
+	gap := e.arrivals.next(1).Seconds()
+	progress := gap // the first request is due at the start
+	last := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for sent := 0; maxRequests <= 0 || sent < maxRequests; {
+		select {
+		case <-timer.C:
+		case <-stop:
+			return false
+		}
+
+		// Shift the schedule by the pause rather than catching up on it
+		paused, ok := e.pause.wait(stop)
+		if !ok {
+			return false
+		}
+		last = last.Add(paused)
+
+		elapsed := e.pause.active() - start
+		if duration > 0 && elapsed >= duration {
+			return true
+		}
+
+		rate := rateAt(elapsed)
+		e.metricsStore.SetTargetRPS(rate)
+		now := time.Now()
+		if rate > 0 {
+			progress += rate * now.Sub(last).Seconds()
+		}
+		last = now
+
+		for rate > 0 && progress >= gap && (maxRequests <= 0 || sent < maxRequests) {
+			// When the cap is reached, wait for a slot. Requests that fall behind
+			// keep their intended start, so the wait is counted in their latency.
+			if e.inFlight != nil {
+				select {
+				case e.inFlight <- struct{}{}:
+				case <-stop:
+					return false
+				}
+			}
+
+			// The request was due when progress reached its gap, possibly before now
+			intendedStart := now.Add(-time.Duration((progress - gap) / rate * float64(time.Second)))
+			progress -= gap
+			gap = e.arrivals.next(1).Seconds()
+
+			reqNum := int(atomic.AddInt64(&e.requestCounter, 1))
+			sent++
+			e.wg.Add(1)
+			go func() {
+				defer e.wg.Done()
+				sendHTTPRequestAt(e.ctx, e.scenario, reqNum, stage, intendedStart, e.metricsStore, e.logger)
+				if e.inFlight != nil {
+					<-e.inFlight
+				}
+			}()
+		}
+
+		// Wake when the next request is due at the current rate, when the
+		// duration ends or to re-evaluate the rate, whichever comes first
+		wait := rampIdleStep
+		if rate > 0 {
+			if due := time.Duration((gap - progress) / rate * float64(time.Second)); due < wait {
+				wait = due
+			}
+		}
+		if duration > 0 {
+			if remaining := duration - elapsed; remaining < wait {
+				wait = remaining
+			}
+		}
+		timer.Reset(wait)
+	}
+	return true
+}
+
+// wait blocks until every request sent by e has completed.
+func (e *rateExecutor) wait() {
+	e.wg.Wait()
+}
+
+// requestsSent returns the number of requests e has sent.
+func (e *rateExecutor) requestsSent() int64 {
+	return atomic.LoadInt64(&e.requestCounter)
+}
+
+// sendConcurrently runs concurrency workers that each send requests back to
+// back until duration elapses, not counting time spent paused. It returns
+// false if stop was closed first.
+func sendConcurrently(ctx context.Context, scenario *Scenario, metricsStore *MetricsStore, stage string, concurrency int, duration time.Duration, requestCounter *int64, pause *PauseGate, stop <-chan struct{}, logger *log.Logger) bool {
+	var wg sync.WaitGroup
+	start := pause.active()
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pause.active()-start < duration {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, ok := pause.wait(stop); !ok {
+					return
+				}
+				reqNum := int(atomic.AddInt64(requestCounter, 1))
+				SendHTTPRequest(ctx, scenario, reqNum, stage, metricsStore, logger)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	select {
+	case <-stop:
+		return false
+	default:
+		return true
+	}
+}
+
+// testWindow bounds a test in time. The returned stop channel is closed once
+// duration has elapsed, not counting time spent paused, or never if duration
+// is zero, or when stopRequested or abort is closed. Once stop is closed,
+// requests still in flight get drain to finish before the returned context
+// is cancelled to abandon them, at once if abort is closed. release must be
+// called when the test has finished.
+func testWindow(duration, drain time.Duration, stopRequested, abort <-chan struct{}, pause *PauseGate) (<-chan struct{}, context.Context, func()) {
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+
+	go func() {
+		start := pause.active()
+		var timer *time.Timer
+		var deadline <-chan time.Time
+		if duration > 0 {
+			timer = time.NewTimer(duration)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+	WindowLoop:
+		for {
+			select {
+			case <-deadline:
+				// Pauses push the deadline back
+				if remaining := duration - (pause.active() - start); remaining > 0 {
+					timer.Reset(remaining)
+					continue
+				}
+			case <-stopRequested:
+			case <-abort:
+			case <-finished:
+				return
+			}
+			break WindowLoop
+		}
+		close(stop)
+
+		drainTimer := time.NewTimer(drain)
+		defer drainTimer.Stop()
+		select {
+		case <-drainTimer.C:
+			cancel()
+		case <-abort:
+			cancel()
+		case <-finished:
+		}
+	}()
+
+	release := func() {
+		close(finished)
+		cancel()
+	}
+	return stop, ctx, release
+}
@@ -0,0 +1,88 @@
+package driver
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+func TestStagedTestingRampFromZeroEndsOnTime(t *testing.T) {
+	var served int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&served, 1)
+	}))
+	defer server.Close()
+
+	logger := log.New(io.Discard, "", 0)
+	driverNode := &DriverNode{NodeID: "node", TestServer: server.URL}
+	scenario, err := NewScenario(&kafka.TestConfigMessage{}, driverNode, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsStore := NewMetricsStore()
+	metricsStore.StartTest()
+
+	stages := []kafka.Stage{{DurationSeconds: 1, TargetRPS: 50}}
+	start := time.Now()
+	StagedTesting(scenario, metricsStore, stages, 0, nil, 0, NewLatch(), make(chan struct{}), make(chan struct{}), NewPauseGate(), logger)
+	elapsed := time.Since(start)
+
+	if elapsed > 1500*time.Millisecond {
+		t.Errorf("1s stage took %s", elapsed)
+	}
+	// Ramping from 0 to 50 RPS over 1s averages 25 RPS
+	if n := atomic.LoadInt64(&served); n < 15 || n > 35 {
+		t.Errorf("served %d requests, want about 25", n)
+	}
+}
+
+func TestStopDrainsRequestsInFlight(t *testing.T) {
+	var started, served int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&started, 1)
+		time.Sleep(300 * time.Millisecond)
+		atomic.AddInt64(&served, 1)
+	}))
+	defer server.Close()
+
+	logger := log.New(io.Discard, "", 0)
+	driverNode := &DriverNode{NodeID: "node", TestServer: server.URL}
+	scenario, err := NewScenario(&kafka.TestConfigMessage{}, driverNode, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsStore := NewMetricsStore()
+	metricsStore.StartTest()
+
+	done := NewLatch()
+	stopRequested := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(stopRequested) })
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ConstantArrivalRateTesting(scenario, metricsStore, 50, 0, nil, 0, 0, 2*time.Second, done, stopRequested, make(chan struct{}), NewPauseGate(), logger)
+	}()
+
+	<-stopRequested
+	select {
+	case <-done.closed():
+		t.Fatal("test ended as soon as it was stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+	<-finished
+
+	select {
+	case <-done.closed():
+	default:
+		t.Error("test did not end once drained")
+	}
+	if s, n := atomic.LoadInt64(&started), atomic.LoadInt64(&served); s == 0 || n != s {
+		t.Errorf("served %d of %d requests in flight", n, s)
+	}
+}
@@ -0,0 +1,39 @@
+package driver
+
+import "net/http"
+
+// requestSize returns the size of req as written in HTTP/1.1, without the
+// connection and TLS overhead.
+func requestSize(req *http.Request) int64 {
+	// Request line: METHOD URI HTTP/1.1\r\n
+	size := int64(len(req.Method) + 1 + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n"))
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	size += int64(len("Host: ") + len(host) + 2)
+	size += headerSize(req.Header) + 2
+	if req.ContentLength > 0 {
+		size += req.ContentLength
+	}
+	return size
+}
+
+// responseHeaderSize returns the size of the status line and headers of
+// resp as received in HTTP/1.1.
+func responseHeaderSize(resp *http.Response) int64 {
+	// Status line: HTTP/1.1 200 OK\r\n
+	size := int64(len("HTTP/1.1 ") + len(resp.Status) + 2)
+	return size + headerSize(resp.Header) + 2
+}
+
+// headerSize returns the size of header's lines, "Name: value\r\n" each.
+func headerSize(header http.Header) int64 {
+	var size int64
+	for name, values := range header {
+		for _, value := range values {
+			size += int64(len(name) + 2 + len(value) + 2)
+		}
+	}
+	return size
+}
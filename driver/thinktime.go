@@ -0,0 +1,29 @@
+package driver
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// thinkTimeDuration draws the next pause between two requests of a virtual user.
+func thinkTimeDuration(thinkTime *kafka.ThinkTime) time.Duration {
+	if thinkTime == nil {
+		return 0
+	}
+
+	switch thinkTime.Distribution {
+	case "uniform":
+		spread := int64(thinkTime.MaxMs - thinkTime.MinMs)
+		if spread <= 0 {
+			return time.Duration(thinkTime.MinMs) * time.Millisecond
+		}
+		return time.Duration(int64(thinkTime.MinMs)+rand.Int63n(spread+1)) * time.Millisecond
+	case "exponential":
+		mean := float64(time.Duration(thinkTime.DurationMs) * time.Millisecond)
+		return time.Duration(rand.ExpFloat64() * mean)
+	default:
+		return time.Duration(thinkTime.DurationMs) * time.Millisecond
+	}
+}
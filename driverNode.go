@@ -73,37 +73,47 @@ func main() {
 		logger.Printf("Driver node registered with ID: %s\n", driverNode.NodeID)
 	}
 
-	metricsStore, err := driver.NewMetricsStore()
-	if err != nil {
-		logger.Fatalf("Error creating MetricsStore: %s", err)
-	}
-	defer metricsStore.Db.Close()
+	metricsStore := driver.NewMetricsStore()
 
 	testConfigChan := make(chan kafka.TestConfigMessage)
-	triggerReceived := make(chan struct{})
+	idle := make(chan struct{})
 
-	go driver.WaitForTestConfig(topics["TestConfigTopic"], topics["TriggerTopic"], consumer, testConfigChan, triggerReceived, logger)
+	go driver.WaitForTestConfig(topics["TestConfigTopic"], topics["TriggerTopic"], consumer, testConfigChan, idle, logger)
+
+	// Stay alive for the orchestrator between tests
+	heart := make(chan struct{})
+	defer close(heart)
+	go driver.SendHeartbeats(topics["HeartbeatTopic"], &driverNode, producer, heart, logger)
 
 ConsumerLoop:
 	for {
 		select {
 		case <-signals:
 			break ConsumerLoop
-		case <-triggerReceived:
-			testConfigMsg, ok := <-testConfigChan
+		case testConfigMsg, ok := <-testConfigChan:
 			if !ok {
-				log.Println("TestConfig Not Received")
+				log.Println("Stopped Receiving Test Configs")
 				break ConsumerLoop // Break loop if testConfigChan is closed
 			}
-			heart := make(chan struct{})
 
 			log.Println("Received Test Config!")
 			driver.HandleTestConfig(testConfigMsg, &driverNode, logger)
 
-			go driver.SendHeartbeats(topics["HeartbeatTopic"], &driverNode, producer, heart, logger)
+			control := make(chan kafka.TriggerMessage)
+			stopControl := make(chan struct{})
+			controlDone := make(chan struct{})
+			go func() {
+				defer close(controlDone)
+				consumer.ConsumeControlMessages(topics["TriggerTopic"], testConfigMsg.TestID, control, stopControl)
+			}()
 
 			log.Println("Starting Load Test!")
-			driver.HandleTrigger(topics["MetricsTopic"], &driverNode, &testConfigMsg, producer, metricsStore, logger)
+			driver.HandleTrigger(topics["MetricsTopic"], &driverNode, &testConfigMsg, producer, metricsStore, control, logger)
+			close(stopControl)
+			<-controlDone // Release the trigger topic before waiting for the next trigger
+
+			log.Println("Load Test Finished, waiting for the next test")
+			idle <- struct{}{} // Accept the next test config
 		}
 	}
 	log.Println("Driver Node is Stopping!")
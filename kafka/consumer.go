@@ -5,12 +5,16 @@ import (
   "log"
   "os"
   "os/signal"
+  "sync"
   "github.com/IBM/sarama"
 )
 
 type Consumer struct {
   Consumer sarama.Consumer
   Logger *log.Logger
+
+  mu      sync.Mutex
+  offsets map[string]int64 // next offset to read from each topic consumed with resumePartition
 }
 
 func NewConsumer(brokers []string, config *sarama.Config, logger *log.Logger) (*Consumer, error) {
@@ -22,6 +26,37 @@ func NewConsumer(brokers []string, config *sarama.Config, logger *log.Logger) (*
 	return &Consumer{Consumer: consumer, Logger: logger}, nil
 }
 
+// resumePartition consumes topic from just after the last message read from
+// it through consumed, or from the newest message if none was. Consumers
+// that come and go between tests use it so that messages published while
+// nobody was consuming are not missed.
+func (c *Consumer) resumePartition(topic string) (sarama.PartitionConsumer, error) {
+	c.mu.Lock()
+	offset, ok := c.offsets[topic]
+	c.mu.Unlock()
+	if !ok {
+		offset = sarama.OffsetNewest
+	}
+
+	partitionConsumer, err := c.Consumer.ConsumePartition(topic, 0, offset)
+	if err == sarama.ErrOffsetOutOfRange {
+		c.Logger.Printf("Offset %d of %s is no longer available, resuming from the newest message\n", offset, topic)
+		partitionConsumer, err = c.Consumer.ConsumePartition(topic, 0, sarama.OffsetNewest)
+	}
+	return partitionConsumer, err
+}
+
+// consumed records that msg was read, so that the next resumePartition of
+// its topic starts after it.
+func (c *Consumer) consumed(msg *sarama.ConsumerMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.offsets == nil {
+		c.offsets = make(map[string]int64)
+	}
+	c.offsets[msg.Topic] = msg.Offset + 1
+}
+
 //creating consumers to consume RegiterMessages, TestConfigMessages, TriggerMessages, MetricsMessages, and HeartbeatMessages
 
 func (c *Consumer) ConsumeRegisterMessages(topic string, messageChan chan<- RegisterMessage, doneChan chan struct{}, numberOfDrivers int) {
@@ -146,8 +181,13 @@ ConsumerLoop:
 	}
 }
 
+// ConsumeTestConfigAndTriggerMessages sends test config messages to
+// testConfigChan and signals triggerReceived when the latest of them is
+// triggered, then returns. It also returns on interrupt, without signalling.
+// Both topics are resumed where the previous call, or ConsumeControlMessages
+// for the trigger topic, left off.
 func (c *Consumer) ConsumeTestConfigAndTriggerMessages(testConfigTopic string, triggerTopic string, testConfigChan chan<- TestConfigMessage, triggerReceived chan<- struct{}) {
-	partitionConsumerTestConfig, err := c.Consumer.ConsumePartition(testConfigTopic, 0, sarama.OffsetNewest)
+	partitionConsumerTestConfig, err := c.resumePartition(testConfigTopic)
 	if err != nil {
 		c.Logger.Println("Error creating partition consumer for test config:", err)
 		return
@@ -160,12 +200,16 @@ func (c *Consumer) ConsumeTestConfigAndTriggerMessages(testConfigTopic string, t
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	var decodedTestConfig TestConfigMessage
+	var triggerMessages <-chan *sarama.ConsumerMessage // nil until a test config is received
 
-ConsumerLoop:
 	for {
 		select {
 		case msg := <-partitionConsumerTestConfig.Messages():
-			var decodedTestConfig TestConfigMessage
+			c.consumed(msg)
+			// A newer test config replaces one that was never triggered
 			err := json.Unmarshal(msg.Value, &decodedTestConfig)
 			if err != nil {
 				c.Logger.Println("Error decoding test config message:", err)
@@ -174,40 +218,81 @@ ConsumerLoop:
 			c.Logger.Println("Consumed Test Config Message:", decodedTestConfig)
 			testConfigChan <- decodedTestConfig // Sending the decoded test config message to the channel
 
+			if triggerMessages != nil {
+				continue
+			}
 			// After receiving a test config message, start consuming from the trigger topic
-			partitionConsumerTrigger, err := c.Consumer.ConsumePartition(triggerTopic, 0, sarama.OffsetNewest)
+			partitionConsumerTrigger, err := c.resumePartition(triggerTopic)
 			if err != nil {
 				c.Logger.Println("Error creating partition consumer for trigger:", err)
 				return
 			}
+			// Released before returning so the test can watch the topic for control messages
 			defer func() {
 				if err := partitionConsumerTrigger.Close(); err != nil {
 					c.Logger.Println("Error closing partition consumer for trigger:", err)
 				}
 			}()
+			triggerMessages = partitionConsumerTrigger.Messages()
+		case msg := <-triggerMessages:
+			c.consumed(msg)
+			var decodedTrigger TriggerMessage
+			err := json.Unmarshal(msg.Value, &decodedTrigger)
+			if err != nil {
+				c.Logger.Println("Error decoding trigger message:", err)
+				continue
+			}
+			c.Logger.Println("Consumed Trigger Message:", decodedTrigger)
 
-			for {
-				select {
-				case msg := <-partitionConsumerTrigger.Messages():
-					var decodedTrigger TriggerMessage
-					err := json.Unmarshal(msg.Value, &decodedTrigger)
-					if err != nil {
-						c.Logger.Println("Error decoding trigger message:", err)
-						continue
-					}
-					c.Logger.Println("Consumed Trigger Message:", decodedTrigger)
-
-					// Compare Test IDs and start load testing if they match
-					if decodedTrigger.TestID == decodedTestConfig.TestID {
-						triggerReceived <- struct{}{} // Send a trigger received signal
-						break ConsumerLoop           // Exit the loop upon receiving the trigger
-					}
-				case <-signals:
-					return // Stop consuming messages on interrupt signal
-				}
+			// Compare Test IDs and start load testing if they match
+			if decodedTrigger.TestID == decodedTestConfig.TestID && decodedTrigger.Trigger == TriggerStart {
+				triggerReceived <- struct{}{} // Send a trigger received signal
+				return
 			}
 		case <-signals:
-			break ConsumerLoop // Stop consuming messages on interrupt signal
+			return // Stop consuming messages on interrupt signal
+		}
+	}
+}
+
+// ConsumeControlMessages sends the trigger messages controlling the running
+// test testID to messageChan until stop is closed. It resumes right after the
+// trigger that started the test, so control messages sent before it opened
+// the topic are not missed.
+func (c *Consumer) ConsumeControlMessages(topic string, testID string, messageChan chan<- TriggerMessage, stop <-chan struct{}) {
+	partitionConsumer, err := c.resumePartition(topic)
+	if err != nil {
+		c.Logger.Println("Error creating partition consumer:", err)
+		return
+	}
+
+	defer func() {
+		if err := partitionConsumer.Close(); err != nil {
+			c.Logger.Println("Error closing partition consumer:", err)
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-partitionConsumer.Messages():
+			c.consumed(msg)
+			var decodedMsg TriggerMessage
+			err := json.Unmarshal(msg.Value, &decodedMsg)
+			if err != nil {
+				c.Logger.Println("Error decoding message:", err)
+				continue
+			}
+			if decodedMsg.TestID != testID || decodedMsg.Trigger == TriggerStart {
+				continue
+			}
+			c.Logger.Println("Consumed Control Message:", decodedMsg)
+			select {
+			case messageChan <- decodedMsg:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
 		}
 	}
 }
@@ -236,8 +321,7 @@ ConsumerLoop:
 	for {
 		select {
 		case msg := <-partitionConsumer.Messages():
-			var decodedMsg MetricsMessage
-			err := json.Unmarshal(msg.Value, &decodedMsg)
+			decodedMsg, err := DecodeMetricsMessage(msg.Value)
 			if err != nil {
 				c.Logger.Println("Error decoding message:", err)
 				continue
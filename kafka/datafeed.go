@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Rows parses the feed's data into one map of column name to value per row.
+// CSV data must start with a header row naming the columns, JSON lines data
+// holds one object per line whose non-string values are kept as JSON.
+func (f *DataFeed) Rows() ([]map[string]string, error) {
+	switch f.Format {
+	case "csv":
+		return parseCSVRows(f.Data)
+	case "jsonl":
+		return parseJSONLinesRows(f.Data)
+	default:
+		return nil, fmt.Errorf("unknown data feed format %q", f.Format)
+	}
+}
+
+func parseCSVRows(data string) ([]map[string]string, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv data feed has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseJSONLinesRows(data string) ([]map[string]string, error) {
+	var rows []map[string]string
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		row := make(map[string]string, len(object))
+		for key, raw := range object {
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				row[key] = s
+			} else {
+				row[key] = string(raw)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
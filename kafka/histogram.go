@@ -0,0 +1,154 @@
+package kafka
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// histogramSubBits sets the histogram precision: values below
+// 1<<histogramSubBits microseconds are counted exactly and larger ones in
+// buckets no wider than 1/64 of their value.
+const histogramSubBits = 7
+
+// Histogram counts latencies in log-linear buckets of microseconds, in the
+// style of HDR histograms, so percentiles can be read without keeping every
+// sample. Histograms from different nodes merge into the histogram of all
+// their samples, which gives correct cluster-wide percentiles. Buckets is
+// sparse, keyed by bucket index. The zero value is an empty histogram.
+type Histogram struct {
+	Buckets    map[int]int64 `json:"buckets"`
+	Count      int64         `json:"count"`
+	Sum        int64         `json:"sum"`         // sum of all values in microseconds
+	SumSquares float64       `json:"sum_squares"` // sum of all squared values in microseconds
+	Min        int64         `json:"min"`
+	Max        int64         `json:"max"`
+}
+
+// Record adds latency to the histogram.
+func (h *Histogram) Record(latency time.Duration) {
+	v := latency.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+
+	if h.Buckets == nil {
+		h.Buckets = make(map[int]int64)
+	}
+	h.Buckets[histogramBucket(v)]++
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Sum += v
+	h.SumSquares += float64(v) * float64(v)
+}
+
+// Merge adds the samples of other to the histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+
+	if h.Buckets == nil {
+		h.Buckets = make(map[int]int64, len(other.Buckets))
+	}
+	for bucket, count := range other.Buckets {
+		h.Buckets[bucket] += count
+	}
+	if h.Count == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	h.SumSquares += other.SumSquares
+}
+
+// Quantile returns the latency below which a fraction q of the samples fall,
+// accurate to the width of the bucket it falls in.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(q * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	buckets := make([]int, 0, len(h.Buckets))
+	for bucket := range h.Buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	var seen int64
+	for _, bucket := range buckets {
+		seen += h.Buckets[bucket]
+		if seen >= rank {
+			// Report the middle of the bucket, within the range actually seen
+			low, high := histogramBucketRange(bucket)
+			v := low + (high-low)/2
+			if v < h.Min {
+				v = h.Min
+			}
+			if v > h.Max {
+				v = h.Max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return time.Duration(h.Max) * time.Microsecond
+}
+
+// Mean returns the mean latency.
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return time.Duration(float64(h.Sum) / float64(h.Count) * float64(time.Microsecond))
+}
+
+// StdDev returns the standard deviation of the latencies.
+func (h *Histogram) StdDev() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	mean := float64(h.Sum) / float64(h.Count)
+	variance := h.SumSquares/float64(h.Count) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance) * float64(time.Microsecond))
+}
+
+// histogramBucket returns the index of the bucket counting v microseconds.
+func histogramBucket(v int64) int {
+	const subBuckets = 1 << histogramSubBits
+	if v < subBuckets {
+		return int(v)
+	}
+	// Keep the top histogramSubBits bits of v, the mantissa falls in [64, 128)
+	shift := bits.Len64(uint64(v)) - histogramSubBits
+	mantissa := int(v >> uint(shift))
+	return subBuckets + (shift-1)*subBuckets/2 + mantissa - subBuckets/2
+}
+
+// histogramBucketRange returns the smallest and largest value counted in
+// bucket.
+func histogramBucketRange(bucket int) (int64, int64) {
+	const subBuckets = 1 << histogramSubBits
+	if bucket < subBuckets {
+		return int64(bucket), int64(bucket)
+	}
+	shift := (bucket-subBuckets)/(subBuckets/2) + 1
+	mantissa := int64((bucket-subBuckets)%(subBuckets/2) + subBuckets/2)
+	return mantissa << uint(shift), (mantissa+1)<<uint(shift) - 1
+}
@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	tests := []struct {
+		v      int64
+		bucket int
+	}{
+		{0, 0},
+		{1, 1},
+		{127, 127},
+		{128, 128},
+		{129, 128},
+		{130, 129},
+		{255, 191},
+		{256, 192},
+		{259, 192},
+		{260, 193},
+		{1000000, 954},
+	}
+	for _, tt := range tests {
+		if got := histogramBucket(tt.v); got != tt.bucket {
+			t.Errorf("histogramBucket(%d) = %d, want %d", tt.v, got, tt.bucket)
+		}
+	}
+}
+
+func TestHistogramBucketRange(t *testing.T) {
+	prevHigh := int64(-1)
+	for bucket := 0; bucket < 2000; bucket++ {
+		low, high := histogramBucketRange(bucket)
+		if low != prevHigh+1 {
+			t.Fatalf("bucket %d starts at %d, want %d", bucket, low, prevHigh+1)
+		}
+		if high < low {
+			t.Fatalf("bucket %d is [%d, %d]", bucket, low, high)
+		}
+		// Buckets are no wider than 1/64 of their values
+		if width := high - low + 1; width > 1 && width*64 > low {
+			t.Fatalf("bucket %d is [%d, %d], wider than 1/64 of its values", bucket, low, high)
+		}
+		for _, v := range []int64{low, high} {
+			if got := histogramBucket(v); got != bucket {
+				t.Fatalf("histogramBucket(%d) = %d, want %d", v, got, bucket)
+			}
+		}
+		prevHigh = high
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := h.Quantile(tt.q)
+		if diff := got - tt.want; diff < -tt.want/64 || diff > tt.want/64 {
+			t.Errorf("Quantile(%v) = %s, want %s within 1/64", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var a, b, all Histogram
+	for i := 1; i <= 50; i++ {
+		d := time.Duration(i) * time.Millisecond
+		a.Record(d)
+		all.Record(d)
+	}
+	for i := 51; i <= 200; i++ {
+		d := time.Duration(i) * 100 * time.Microsecond
+		b.Record(d)
+		all.Record(d)
+	}
+
+	var merged Histogram
+	merged.Merge(&a)
+	merged.Merge(&b)
+	merged.Merge(nil)
+	merged.Merge(&Histogram{})
+
+	if merged.Count != all.Count || merged.Sum != all.Sum || merged.SumSquares != all.SumSquares {
+		t.Errorf("merged count %d sum %d sum squares %v, want %d %d %v",
+			merged.Count, merged.Sum, merged.SumSquares, all.Count, all.Sum, all.SumSquares)
+	}
+	if merged.Min != all.Min || merged.Max != all.Max {
+		t.Errorf("merged min %d max %d, want %d %d", merged.Min, merged.Max, all.Min, all.Max)
+	}
+	if len(merged.Buckets) != len(all.Buckets) {
+		t.Errorf("merged has %d buckets, want %d", len(merged.Buckets), len(all.Buckets))
+	}
+	for bucket, count := range all.Buckets {
+		if merged.Buckets[bucket] != count {
+			t.Errorf("bucket %d has %d samples, want %d", bucket, merged.Buckets[bucket], count)
+		}
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		if merged.Quantile(q) != all.Quantile(q) {
+			t.Errorf("merged Quantile(%v) = %s, want %s", q, merged.Quantile(q), all.Quantile(q))
+		}
+	}
+}
+
+func TestHistogramMergeIntoEmptyKeepsMin(t *testing.T) {
+	var h, other Histogram
+	other.Record(5 * time.Millisecond)
+	h.Merge(&other)
+	if h.Min != 5000 || h.Max != 5000 || h.Count != 1 {
+		t.Errorf("got min %d max %d count %d, want 5000 5000 1", h.Min, h.Max, h.Count)
+	}
+
+	// Merging must not share the other histogram's buckets
+	other.Record(time.Millisecond)
+	if h.Count != 1 || len(h.Buckets) != 1 {
+		t.Errorf("histogram changed with the one merged into it: %+v", h)
+	}
+}
@@ -12,25 +12,197 @@ type TestConfigMessage struct {
   TestType               string `json:"test_type"`
   TestMessageDelay       int `json:"test_message_delay"`
   MessageCountPerDriver  int `json:"message_count_per_driver"`
+  RampStartRPS           float64 `json:"ramp_start_rps,omitempty"`        // RAMP: request rate at the start of the ramp
+  RampTargetRPS          float64 `json:"ramp_target_rps,omitempty"`       // RAMP: request rate reached at the end of the ramp
+  RampDurationSeconds    int `json:"ramp_duration_seconds,omitempty"`     // RAMP: time taken to go from start to target rate
+  HoldDurationSeconds    int `json:"hold_duration_seconds,omitempty"`     // RAMP: time spent at the target rate after the ramp
+  Stages                 []Stage `json:"stages,omitempty"`                // STAGED: stages executed in order
+  ArrivalRate            float64 `json:"arrival_rate,omitempty"`          // CONSTANT_ARRIVAL_RATE: requests started per second
+  MaxInFlight            int `json:"max_in_flight,omitempty"`             // rate-based tests: cap on outstanding requests, 0 for no cap
+  VirtualUsers           int `json:"virtual_users,omitempty"`             // VIRTUAL_USERS: number of looping users per driver
+  IterationsPerUser      int `json:"iterations_per_user,omitempty"`       // VIRTUAL_USERS: requests each user sends, 0 for no limit
+  DurationSeconds        int `json:"duration_seconds,omitempty"`          // how long the test sends requests, 0 for no limit
+  GracefulDrainSeconds   int `json:"graceful_drain_seconds,omitempty"`    // time in-flight requests get to finish once the test stops
+  ThinkTime              *ThinkTime `json:"think_time,omitempty"`         // VIRTUAL_USERS: pause between a user's requests
+  Arrival                *ArrivalDistribution `json:"arrival,omitempty"` // rate-based tests: how requests are spaced in time
+  Request                *RequestSpec `json:"request,omitempty"`          // request to send, a GET of TestServer if unset
+  Requests               []RequestSpec `json:"requests,omitempty"`        // requests to pick from by weight, overrides Request
+  Steps                  []RequestSpec `json:"steps,omitempty"`           // journey run in order each iteration, overrides Requests
+  DataFeed               *DataFeed `json:"data_feed,omitempty"`           // rows whose columns requests reference as variables
+  MetricsIntervalMs      int `json:"metrics_interval_ms,omitempty"`       // length of the windows drivers report metrics for, 1000 if unset
+  Thresholds             []string `json:"thresholds,omitempty"`         // conditions such as "p95 < 300ms" the test must meet to pass
+  AbortOn                []string `json:"abort_on,omitempty"`           // conditions such as "error_rate > 20% for 30s" that abort the test
 }
 
+// DataFeed is a CSV or JSON lines file attached to a test. Each iteration
+// takes one row and its columns are available to request templates as
+// {{.column}}. Mode picks rows "sequential"ly, at "random", or "unique"ly:
+// the orchestrator partitions rows across live drivers in Partitions, keyed
+// by node ID, so no two drivers use the same row, and a driver stops once its
+// rows run out.
+type DataFeed struct {
+  Format     string           `json:"format"`
+  Data       string           `json:"data"`
+  Mode       string           `json:"mode"`
+  Partitions map[string][]int `json:"partitions,omitempty"`
+}
+
+// RequestSpec describes the HTTP request a driver sends. An empty Method means
+// GET and an empty URL means the test's TestServer. The body is taken from
+// BodyBase64 when set, for binary payloads, and from Body otherwise.
+// Name and Weight are used when picking among several requests: metrics are
+// reported per Name (defaulting to the method and path) and each request is
+// picked with probability proportional to its Weight (defaulting to 1).
+type RequestSpec struct {
+  Name        string            `json:"name,omitempty"`
+  Weight      int               `json:"weight,omitempty"`
+  Method      string            `json:"method,omitempty"`
+  URL         string            `json:"url,omitempty"`
+  Headers     map[string]string `json:"headers,omitempty"`
+  Query       map[string]string `json:"query,omitempty"`
+  Body        string            `json:"body,omitempty"`
+  BodyBase64  string            `json:"body_base64,omitempty"`
+  ContentType string            `json:"content_type,omitempty"`
+  Extract     []Extraction      `json:"extract,omitempty"`
+  Checks      []Check           `json:"checks,omitempty"`
+}
+
+// Check is an assertion made on every response to a request. Type is
+// "status" (the status code is one of Status, any 2xx if empty),
+// "body_contains" (the body contains Value), "body_regex" (the body matches
+// the regular expression Value), "json_path" (the value at the dotted Path
+// equals Value), "max_latency" (the response took at most MaxLatencyMs) or
+// "max_body_size" (the body is at most MaxBytes long). Pass and fail counts
+// are reported per Name, defaulting to the request name and check type.
+type Check struct {
+  Name         string `json:"name,omitempty"`
+  Type         string `json:"type"`
+  Status       []int  `json:"status,omitempty"`
+  Value        string `json:"value,omitempty"`
+  Path         string `json:"path,omitempty"`
+  MaxLatencyMs int    `json:"max_latency_ms,omitempty"`
+  MaxBytes     int    `json:"max_bytes,omitempty"`
+}
+
+// Extraction stores a value from a journey step's response in a variable that
+// later steps reference as {{.Name}} in their URL, query, headers and body.
+// From is "json" (Expression is a dotted path such as "data.token"),
+// "header" (Expression is the header name) or "regex" (Expression is a
+// regular expression, its first capture group is used if it has one).
+type Extraction struct {
+  Name       string `json:"name"`
+  From       string `json:"from"`
+  Expression string `json:"expression"`
+}
+
+// ArrivalDistribution describes how a rate-based test spaces its requests.
+// Type is "constant" (evenly spaced), "poisson" (exponential gaps),
+// "uniform" (gaps jittered by up to JitterPercent of the mean) or "burst"
+// (BurstSize requests at once, spaced to keep the average rate).
+type ArrivalDistribution struct {
+  Type          string  `json:"type"`
+  JitterPercent float64 `json:"jitter_percent,omitempty"`
+  BurstSize     int     `json:"burst_size,omitempty"`
+}
+
+// ThinkTime describes how long a virtual user pauses between requests.
+// Distribution is "fixed" (DurationMs), "uniform" (between MinMs and MaxMs)
+// or "exponential" (with a mean of DurationMs).
+type ThinkTime struct {
+  Distribution string `json:"distribution"`
+  DurationMs   int    `json:"duration_ms,omitempty"`
+  MinMs        int    `json:"min_ms,omitempty"`
+  MaxMs        int    `json:"max_ms,omitempty"`
+}
+
+// Stage is one step of a STAGED test. A stage either drives a request rate,
+// ramping linearly from the previous stage's target, or a fixed number of
+// concurrent workers.
+type Stage struct {
+  Name            string  `json:"name,omitempty"`
+  DurationSeconds int     `json:"duration_seconds"`
+  TargetRPS       float64 `json:"target_rps,omitempty"`
+  Concurrency     int     `json:"concurrency,omitempty"`
+}
+
+// Trigger values. TriggerStart starts the test whose config drivers
+// received; the others control a running test.
+const (
+  TriggerStart  = "YES"    // start the test
+  TriggerStop   = "STOP"   // stop sending requests, let in-flight ones drain
+  TriggerPause  = "PAUSE"  // suspend sending requests
+  TriggerResume = "RESUME" // resume sending requests where they were paused
+  TriggerAbort  = "ABORT"  // stop sending requests and cancel in-flight ones
+)
+
 type TriggerMessage struct {
   TestID  string `json:"test_id"`
   Trigger string `json:"trigger"`
 }
 
+// MetricsVersion is the version of the MetricsMessage format drivers
+// produce. Version 1 messages, which carry latencies as duration strings and
+// have no version field, are upgraded by DecodeMetricsMessage.
+const MetricsVersion = 2
+
+// MetricsMessage reports the metrics of a driver node. The metrics cover the
+// requests completed between WindowStartMs and WindowEndMs, Unix times in
+// milliseconds. Drivers report one window per metrics interval, numbered by
+// Sequence from 1, and the last window of a test is Final. Version 1
+// messages have no Sequence and report everything since the test started.
 type MetricsMessage struct {
+  Version   int    `json:"version"`
   NodeID    string `json:"node_id"`
   TestID    string `json:"test_id"`
   ReportID  string `json:"report_id"`
+  Sequence  int64  `json:"sequence,omitempty"`
+  Final     bool   `json:"final,omitempty"`
+  Error     string `json:"error,omitempty"` // why the node could not run the test, set on its final window
+  Stage     string `json:"stage,omitempty"` // stage active when the report was produced
+  Paused    bool   `json:"paused,omitempty"` // the test was paused during the window
+  WindowStartMs  int64 `json:"window_start_ms,omitempty"`            // start of the time window the metrics cover
+  WindowEndMs    int64 `json:"window_end_ms,omitempty"`              // end of the time window the metrics cover
+  ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"` // time since the node started the test
+  RPS            float64 `json:"rps"`                            // requests per second achieved over the window
+  TargetRPS      float64 `json:"target_rps,omitempty"`           // request rate the node was asked for at the end of the window, 0 if it has none
   Metrics   MetricsData `json:"metrics"`
+  StageMetrics map[string]MetricsData `json:"stage_metrics,omitempty"` // metrics for requests sent during each stage
+  EndpointMetrics map[string]MetricsData `json:"endpoint_metrics,omitempty"` // metrics for requests sent to each endpoint
+  Checks    map[string]CheckResult `json:"checks,omitempty"` // pass and fail counts per check
+}
+
+type CheckResult struct {
+  Passes int64 `json:"passes"`
+  Fails  int64 `json:"fails"`
 }
 
+// MetricsData summarises a set of requests. Latencies, in microseconds,
+// cover requests that got a response, up to the end of its body, and are
+// computed from Histogram. Phases breaks them down into the phases of a
+// request, with only latency fields set.
+// Errors counts requests that failed without a response, broken down by
+// ErrorClasses ("dns", "connection_refused", "timeout", "tls", "reset" or
+// "other"), plus responses with a 4xx or 5xx status. Requests cancelled
+// because the test was stopped or aborted are only counted in Canceled.
 type MetricsData struct {
-  MeanLatency   string `json:"mean_latency"`
-  MedianLatency string `json:"median_latency"`
-  MinLatency    string `json:"min_latency"`
-  MaxLatency    string `json:"max_latency"`
+  MeanLatencyUs   int64 `json:"mean_latency_us"`
+  MedianLatencyUs int64 `json:"median_latency_us"`
+  MinLatencyUs    int64 `json:"min_latency_us"`
+  MaxLatencyUs    int64 `json:"max_latency_us"`
+  P90LatencyUs    int64 `json:"p90_latency_us"`
+  P95LatencyUs    int64 `json:"p95_latency_us"`
+  P99LatencyUs    int64 `json:"p99_latency_us"`
+  P999LatencyUs   int64 `json:"p999_latency_us"`
+  StdDevLatencyUs int64 `json:"stddev_latency_us"`
+  Histogram       *Histogram `json:"histogram,omitempty"`            // latencies of the requests, merged to combine MetricsData
+  Phases          map[string]MetricsData `json:"phases,omitempty"` // latencies of each request phase: "dns", "connect", "tls", "ttfb" or "transfer"
+  Requests        int64 `json:"requests"`                         // requests sent, with or without a response
+  BytesSent       int64 `json:"bytes_sent"`                       // size of the requests that got a response
+  BytesReceived   int64 `json:"bytes_received"`                   // size of the responses, headers and full body
+  Errors          int64 `json:"errors"`                           // failed requests and 4xx/5xx responses
+  StatusCodes     map[int]int64 `json:"status_codes,omitempty"`   // responses per HTTP status code
+  ErrorClasses    map[string]int64 `json:"error_classes,omitempty"` // requests without a response per error class
+  Canceled        int64 `json:"canceled,omitempty"`               // requests cancelled by the end of the test, not in Requests or Errors
 }
 
 type HeartbeatMessage struct {
@@ -0,0 +1,137 @@
+package kafka
+
+import "encoding/json"
+
+// DecodeMetricsMessage decodes a MetricsMessage of any version, upgrading
+// older versions to the current one.
+func DecodeMetricsMessage(data []byte) (MetricsMessage, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return MetricsMessage{}, err
+	}
+
+	if header.Version >= 2 {
+		var msg MetricsMessage
+		err := json.Unmarshal(data, &msg)
+		return msg, err
+	}
+
+	var legacy MetricsMessageV1
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return MetricsMessage{}, err
+	}
+	return legacy.Upgrade(), nil
+}
+
+// Merge adds the metrics of window, the next window reported by the same
+// node, to m, which then covers both.
+func (m *MetricsMessage) Merge(window MetricsMessage) {
+	if m.WindowStartMs == 0 || (window.WindowStartMs != 0 && window.WindowStartMs < m.WindowStartMs) {
+		m.WindowStartMs = window.WindowStartMs
+	}
+	if window.WindowEndMs > m.WindowEndMs {
+		m.WindowEndMs = window.WindowEndMs
+	}
+	if window.ElapsedSeconds > m.ElapsedSeconds {
+		m.ElapsedSeconds = window.ElapsedSeconds
+	}
+	m.Version = window.Version
+	m.NodeID = window.NodeID
+	m.TestID = window.TestID
+	m.ReportID = window.ReportID
+	m.Sequence = window.Sequence
+	m.Final = m.Final || window.Final
+	if window.Error != "" {
+		m.Error = window.Error
+	}
+	m.Stage = window.Stage
+	m.Paused = window.Paused
+	m.TargetRPS = window.TargetRPS
+
+	m.Metrics.Merge(window.Metrics)
+	m.StageMetrics = mergeMetricsDataMap(m.StageMetrics, window.StageMetrics)
+	m.EndpointMetrics = mergeMetricsDataMap(m.EndpointMetrics, window.EndpointMetrics)
+	if m.WindowEndMs > m.WindowStartMs {
+		m.RPS = float64(m.Metrics.Requests) / (float64(m.WindowEndMs-m.WindowStartMs) / 1000)
+	}
+	for name, result := range window.Checks {
+		if m.Checks == nil {
+			m.Checks = make(map[string]CheckResult)
+		}
+		total := m.Checks[name]
+		total.Passes += result.Passes
+		total.Fails += result.Fails
+		m.Checks[name] = total
+	}
+}
+
+// mergeMetricsDataMap merges each entry of other into the same key of into,
+// creating into if needed, and returns into.
+func mergeMetricsDataMap(into map[string]MetricsData, other map[string]MetricsData) map[string]MetricsData {
+	for key, data := range other {
+		if into == nil {
+			into = make(map[string]MetricsData)
+		}
+		merged := into[key]
+		merged.Merge(data)
+		into[key] = merged
+	}
+	return into
+}
+
+// NewMetricsData summarises the latencies recorded in h. The MetricsData
+// keeps h so it can be merged with others.
+func NewMetricsData(h *Histogram) MetricsData {
+	var d MetricsData
+	if h != nil && h.Count > 0 {
+		d.Histogram = h
+		d.setLatencies()
+	}
+	return d
+}
+
+// Merge adds the requests summarised by other to d, recomputing latencies
+// from the merged histograms.
+func (d *MetricsData) Merge(other MetricsData) {
+	if other.Histogram != nil && other.Histogram.Count > 0 {
+		if d.Histogram == nil {
+			d.Histogram = &Histogram{}
+		}
+		d.Histogram.Merge(other.Histogram)
+		d.setLatencies()
+	}
+	d.Phases = mergeMetricsDataMap(d.Phases, other.Phases)
+
+	d.Requests += other.Requests
+	d.BytesSent += other.BytesSent
+	d.BytesReceived += other.BytesReceived
+	d.Errors += other.Errors
+	d.Canceled += other.Canceled
+	for status, count := range other.StatusCodes {
+		if d.StatusCodes == nil {
+			d.StatusCodes = make(map[int]int64)
+		}
+		d.StatusCodes[status] += count
+	}
+	for class, count := range other.ErrorClasses {
+		if d.ErrorClasses == nil {
+			d.ErrorClasses = make(map[string]int64)
+		}
+		d.ErrorClasses[class] += count
+	}
+}
+
+func (d *MetricsData) setLatencies() {
+	h := d.Histogram
+	d.MeanLatencyUs = h.Mean().Microseconds()
+	d.MedianLatencyUs = h.Quantile(0.5).Microseconds()
+	d.MinLatencyUs = h.Min
+	d.MaxLatencyUs = h.Max
+	d.P90LatencyUs = h.Quantile(0.9).Microseconds()
+	d.P95LatencyUs = h.Quantile(0.95).Microseconds()
+	d.P99LatencyUs = h.Quantile(0.99).Microseconds()
+	d.P999LatencyUs = h.Quantile(0.999).Microseconds()
+	d.StdDevLatencyUs = h.StdDev().Microseconds()
+}
@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeBaselineMetricsMessage(t *testing.T) {
+	// As sent by drivers from before metrics messages had a version
+	data := []byte(`{
+		"node_id": "node",
+		"test_id": "test",
+		"report_id": "report",
+		"metrics": {
+			"mean_latency": "1.5ms",
+			"median_latency": "1.2ms",
+			"min_latency": "800µs",
+			"max_latency": "1.002s"
+		}
+	}`)
+
+	msg, err := DecodeMetricsMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version != MetricsVersion {
+		t.Errorf("version %d, want %d", msg.Version, MetricsVersion)
+	}
+	if msg.NodeID != "node" || msg.TestID != "test" || msg.ReportID != "report" {
+		t.Errorf("ids %s/%s/%s, want node/test/report", msg.NodeID, msg.TestID, msg.ReportID)
+	}
+	latencies := []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"mean", msg.Metrics.MeanLatencyUs, 1500},
+		{"median", msg.Metrics.MedianLatencyUs, 1200},
+		{"min", msg.Metrics.MinLatencyUs, 800},
+		{"max", msg.Metrics.MaxLatencyUs, 1002000},
+		{"p95", msg.Metrics.P95LatencyUs, 0},
+	}
+	for _, l := range latencies {
+		if l.got != l.want {
+			t.Errorf("%s latency %dus, want %dus", l.name, l.got, l.want)
+		}
+	}
+	if msg.Metrics.Histogram != nil {
+		t.Error("baseline metrics have no histogram to merge")
+	}
+}
+
+func TestDecodeV1MetricsMessageWithHistogram(t *testing.T) {
+	h := &Histogram{}
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	legacy := MetricsMessageV1{
+		NodeID:         "node",
+		TestID:         "test",
+		ElapsedSeconds: 2,
+		Metrics:        MetricsDataV1{MeanLatency: "1h", Histogram: h, Requests: 100, Errors: 3},
+		StageMetrics:   map[string]MetricsDataV1{"warmup": {MaxLatency: "2ms"}},
+	}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := DecodeMetricsMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Latencies come from the histogram, not the duration strings
+	if want := h.Mean().Microseconds(); msg.Metrics.MeanLatencyUs != want {
+		t.Errorf("mean latency %dus, want %dus", msg.Metrics.MeanLatencyUs, want)
+	}
+	if msg.Metrics.Requests != 100 || msg.Metrics.Errors != 3 {
+		t.Errorf("%d requests and %d errors, want 100 and 3", msg.Metrics.Requests, msg.Metrics.Errors)
+	}
+	if msg.RPS != 50 {
+		t.Errorf("rps %v, want 50", msg.RPS)
+	}
+	if got := msg.StageMetrics["warmup"].MaxLatencyUs; got != 2000 {
+		t.Errorf("warmup max latency %dus, want 2000us", got)
+	}
+}
+
+func TestDecodeMetricsMessageRoundTrip(t *testing.T) {
+	h := &Histogram{}
+	h.Record(3 * time.Millisecond)
+	h.Record(7 * time.Millisecond)
+	data := NewMetricsData(h)
+	data.Requests = 2
+	data.StatusCodes = map[int]int64{200: 2}
+	want := MetricsMessage{
+		Version:         MetricsVersion,
+		NodeID:          "node",
+		TestID:          "test",
+		ReportID:        "report",
+		Sequence:        4,
+		Final:           true,
+		WindowStartMs:   1000,
+		WindowEndMs:     2000,
+		RPS:             2,
+		Metrics:         data,
+		EndpointMetrics: map[string]MetricsData{"GET /": data},
+		Checks:          map[string]CheckResult{"status is 200": {Passes: 2}},
+	}
+	encoded, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeMetricsMessage(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
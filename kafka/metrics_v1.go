@@ -0,0 +1,99 @@
+package kafka
+
+import "time"
+
+// MetricsMessageV1 is the version 1 metrics format, with latencies as
+// duration strings such as "1.002s". It is only decoded, to accept metrics
+// from drivers that have not been upgraded yet.
+type MetricsMessageV1 struct {
+	NodeID          string                   `json:"node_id"`
+	TestID          string                   `json:"test_id"`
+	ReportID        string                   `json:"report_id"`
+	Stage           string                   `json:"stage,omitempty"`
+	ElapsedSeconds  float64                  `json:"elapsed_seconds,omitempty"`
+	Metrics         MetricsDataV1            `json:"metrics"`
+	StageMetrics    map[string]MetricsDataV1 `json:"stage_metrics,omitempty"`
+	EndpointMetrics map[string]MetricsDataV1 `json:"endpoint_metrics,omitempty"`
+	Checks          map[string]CheckResult   `json:"checks,omitempty"`
+}
+
+// MetricsDataV1 is the version 1 form of MetricsData.
+type MetricsDataV1 struct {
+	MeanLatency   string           `json:"mean_latency"`
+	MedianLatency string           `json:"median_latency"`
+	MinLatency    string           `json:"min_latency"`
+	MaxLatency    string           `json:"max_latency"`
+	P90Latency    string           `json:"p90_latency,omitempty"`
+	P95Latency    string           `json:"p95_latency,omitempty"`
+	P99Latency    string           `json:"p99_latency,omitempty"`
+	P999Latency   string           `json:"p999_latency,omitempty"`
+	StdDevLatency string           `json:"stddev_latency,omitempty"`
+	Histogram     *Histogram       `json:"histogram,omitempty"`
+	Requests      int64            `json:"requests,omitempty"`
+	Errors        int64            `json:"errors,omitempty"`
+	StatusCodes   map[int]int64    `json:"status_codes,omitempty"`
+	ErrorClasses  map[string]int64 `json:"error_classes,omitempty"`
+}
+
+// Upgrade converts m to the current MetricsMessage format.
+func (m MetricsMessageV1) Upgrade() MetricsMessage {
+	msg := MetricsMessage{
+		Version:        MetricsVersion,
+		NodeID:         m.NodeID,
+		TestID:         m.TestID,
+		ReportID:       m.ReportID,
+		Stage:          m.Stage,
+		ElapsedSeconds: m.ElapsedSeconds,
+		Metrics:        m.Metrics.Upgrade(),
+		Checks:         m.Checks,
+	}
+	if m.ElapsedSeconds > 0 {
+		msg.RPS = float64(msg.Metrics.Requests) / m.ElapsedSeconds
+	}
+	if len(m.StageMetrics) > 0 {
+		msg.StageMetrics = make(map[string]MetricsData, len(m.StageMetrics))
+		for stage, data := range m.StageMetrics {
+			msg.StageMetrics[stage] = data.Upgrade()
+		}
+	}
+	if len(m.EndpointMetrics) > 0 {
+		msg.EndpointMetrics = make(map[string]MetricsData, len(m.EndpointMetrics))
+		for endpoint, data := range m.EndpointMetrics {
+			msg.EndpointMetrics[endpoint] = data.Upgrade()
+		}
+	}
+	return msg
+}
+
+// Upgrade converts d to the current MetricsData format. Latencies are
+// recomputed from the histogram when d has one and parsed from the duration
+// strings otherwise, in which case they cannot be merged.
+func (d MetricsDataV1) Upgrade() MetricsData {
+	data := NewMetricsData(d.Histogram)
+	if d.Histogram == nil {
+		data.MeanLatencyUs = parseLatencyV1(d.MeanLatency)
+		data.MedianLatencyUs = parseLatencyV1(d.MedianLatency)
+		data.MinLatencyUs = parseLatencyV1(d.MinLatency)
+		data.MaxLatencyUs = parseLatencyV1(d.MaxLatency)
+		data.P90LatencyUs = parseLatencyV1(d.P90Latency)
+		data.P95LatencyUs = parseLatencyV1(d.P95Latency)
+		data.P99LatencyUs = parseLatencyV1(d.P99Latency)
+		data.P999LatencyUs = parseLatencyV1(d.P999Latency)
+		data.StdDevLatencyUs = parseLatencyV1(d.StdDevLatency)
+	}
+	data.Requests = d.Requests
+	data.Errors = d.Errors
+	data.StatusCodes = d.StatusCodes
+	data.ErrorClasses = d.ErrorClasses
+	return data
+}
+
+// parseLatencyV1 returns a version 1 latency in microseconds, 0 if it is
+// empty or invalid.
+func parseLatencyV1(latency string) int64 {
+	d, err := time.ParseDuration(latency)
+	if err != nil {
+		return 0
+	}
+	return d.Microseconds()
+}
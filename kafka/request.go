@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ParsedRequest is a RequestSpec resolved once per test, so that sending it
+// only has to substitute variables: its templates are parsed, its binary
+// body decoded and the regular expressions of its extractions and checks
+// compiled.
+type ParsedRequest struct {
+	Method         string
+	URL            ValueTemplate
+	Query          map[string]ValueTemplate
+	Headers        map[string]ValueTemplate // keyed by canonical name, without Host
+	Host           ValueTemplate
+	Body           ValueTemplate
+	Binary         []byte           // decoded BodyBase64, sent as is
+	ExtractRegexps []*regexp.Regexp // compiled expression of each of Extract, nil unless From is "regex"
+	CheckRegexps   []*regexp.Regexp // compiled value of each of Checks, nil unless Type is "body_regex"
+}
+
+// ParseRequestSpec parses spec, defaulting to a GET of testServer, with funcs
+// available to its templates. Drivers prepare their requests with it, and the
+// orchestrator rejects the specs it fails on before sending them to drivers.
+func ParseRequestSpec(spec RequestSpec, testServer string, funcs template.FuncMap) (ParsedRequest, error) {
+	method := strings.ToUpper(spec.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	rawURL := spec.URL
+	if rawURL == "" {
+		rawURL = testServer
+	}
+
+	parsed := ParsedRequest{
+		Method:  method,
+		Query:   make(map[string]ValueTemplate, len(spec.Query)),
+		Headers: make(map[string]ValueTemplate, len(spec.Headers)),
+	}
+
+	var err error
+	if parsed.URL, err = NewValueTemplate(rawURL, funcs); err != nil {
+		return ParsedRequest{}, err
+	}
+	for k, v := range spec.Query {
+		if parsed.Query[k], err = NewValueTemplate(v, funcs); err != nil {
+			return ParsedRequest{}, err
+		}
+	}
+	for k, v := range spec.Headers {
+		tmpl, err := NewValueTemplate(v, funcs)
+		if err != nil {
+			return ParsedRequest{}, err
+		}
+		// The Host header is carried on the request itself, not in its header map
+		if strings.EqualFold(k, "Host") {
+			parsed.Host = tmpl
+			continue
+		}
+		parsed.Headers[http.CanonicalHeaderKey(k)] = tmpl
+	}
+	if spec.ContentType != "" {
+		parsed.Headers["Content-Type"] = ValueTemplate{raw: spec.ContentType}
+	}
+
+	if spec.BodyBase64 != "" {
+		parsed.Binary, err = base64.StdEncoding.DecodeString(spec.BodyBase64)
+		if err != nil {
+			return ParsedRequest{}, fmt.Errorf("invalid body_base64: %w", err)
+		}
+	} else if parsed.Body, err = NewValueTemplate(spec.Body, funcs); err != nil {
+		return ParsedRequest{}, err
+	}
+
+	parsed.ExtractRegexps = make([]*regexp.Regexp, len(spec.Extract))
+	for i, e := range spec.Extract {
+		if e.From != "regex" {
+			continue
+		}
+		if parsed.ExtractRegexps[i], err = regexp.Compile(e.Expression); err != nil {
+			return ParsedRequest{}, fmt.Errorf("invalid regex for %s: %w", e.Name, err)
+		}
+	}
+	parsed.CheckRegexps = make([]*regexp.Regexp, len(spec.Checks))
+	for i, c := range spec.Checks {
+		if c.Type != "body_regex" {
+			continue
+		}
+		if parsed.CheckRegexps[i], err = regexp.Compile(c.Value); err != nil {
+			return ParsedRequest{}, fmt.Errorf("invalid regex for check %d: %w", i+1, err)
+		}
+	}
+	return parsed, nil
+}
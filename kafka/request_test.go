@@ -0,0 +1,75 @@
+package kafka
+
+import "testing"
+
+func TestParseRequestSpec(t *testing.T) {
+	spec := RequestSpec{
+		URL:         "http://{{.host}}/items/{{requestNumber}}",
+		Headers:     map[string]string{"x-id": "{{uuid}}", "host": "{{.host}}"},
+		Query:       map[string]string{"n": "{{randInt 1 5}}"},
+		Body:        `{"seq": {{seq}}}`,
+		ContentType: "application/json",
+		Extract:     []Extraction{{Name: "token", From: "json", Expression: "token"}, {Name: "id", From: "regex", Expression: `id=(\d+)`}},
+		Checks:      []Check{{Type: "status"}, {Type: "body_regex", Value: "ok|fine"}},
+	}
+	parsed, err := ParseRequestSpec(spec, "", TemplateFuncs("node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Method != "GET" {
+		t.Errorf("method %q, want GET", parsed.Method)
+	}
+	url, err := parsed.URL.Render(map[string]string{"host": "example.com"}, 7)
+	if err != nil || url != "http://example.com/items/7" {
+		t.Errorf("url rendered to %q, %v", url, err)
+	}
+	if _, ok := parsed.Headers["X-Id"]; !ok {
+		t.Errorf("headers %v lack X-Id", parsed.Headers)
+	}
+	if _, ok := parsed.Headers["Host"]; ok || parsed.Host.Raw() != "{{.host}}" {
+		t.Errorf("host header not carried apart: headers %v, host %q", parsed.Headers, parsed.Host.Raw())
+	}
+	if parsed.Headers["Content-Type"].Raw() != "application/json" {
+		t.Errorf("content type %q", parsed.Headers["Content-Type"].Raw())
+	}
+	if parsed.ExtractRegexps[0] != nil || parsed.ExtractRegexps[1] == nil {
+		t.Errorf("extract regexps %v, want only the second", parsed.ExtractRegexps)
+	}
+	if parsed.CheckRegexps[0] != nil || parsed.CheckRegexps[1] == nil {
+		t.Errorf("check regexps %v, want only the second", parsed.CheckRegexps)
+	}
+}
+
+func TestParseRequestSpecDefaults(t *testing.T) {
+	parsed, err := ParseRequestSpec(RequestSpec{Method: "post", BodyBase64: "AAEC"}, "http://server", TemplateFuncs(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method != "POST" || parsed.URL.Raw() != "http://server" {
+		t.Errorf("got %s %s, want POST http://server", parsed.Method, parsed.URL.Raw())
+	}
+	if string(parsed.Binary) != "\x00\x01\x02" {
+		t.Errorf("binary body %q", parsed.Binary)
+	}
+}
+
+func TestParseRequestSpecInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec RequestSpec
+	}{
+		{"unknown function", RequestSpec{URL: "http://host/{{nosuchfunc}}"}},
+		{"unclosed action", RequestSpec{URL: "http://host/", Headers: map[string]string{"x": "{{.unclosed"}}},
+		{"bad query template", RequestSpec{URL: "http://host/", Query: map[string]string{"q": "{{if}}"}}},
+		{"bad body template", RequestSpec{URL: "http://host/", Body: "{{end}}"}},
+		{"bad base64", RequestSpec{URL: "http://host/", BodyBase64: "not base64!"}},
+		{"bad extract regex", RequestSpec{URL: "http://host/", Extract: []Extraction{{Name: "x", From: "regex", Expression: "("}}}},
+		{"bad check regex", RequestSpec{URL: "http://host/", Checks: []Check{{Type: "body_regex", Value: "[a-"}}}},
+	}
+	for _, tt := range tests {
+		if _, err := ParseRequestSpec(tt.spec, "", TemplateFuncs("")); err == nil {
+			t.Errorf("%s: want an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ValueTemplate is a request value, such as a URL, header or body, that may
+// reference variables as {{.name}} and call the built-in generators from
+// TemplateFuncs. Values without template actions are used as is without
+// executing a template.
+type ValueTemplate struct {
+	raw               string
+	tmpl              *template.Template
+	usesRequestNumber bool
+}
+
+// NewValueTemplate parses raw with funcs available to it.
+func NewValueTemplate(raw string, funcs template.FuncMap) (ValueTemplate, error) {
+	if !strings.Contains(raw, "{{") {
+		return ValueTemplate{raw: raw}, nil
+	}
+
+	// Referencing a variable that was never set is an error rather than an empty string
+	tmpl, err := template.New("").Option("missingkey=error").Funcs(funcs).Parse(raw)
+	if err != nil {
+		return ValueTemplate{}, fmt.Errorf("invalid template %q: %w", raw, err)
+	}
+	return ValueTemplate{raw: raw, tmpl: tmpl, usesRequestNumber: strings.Contains(raw, "requestNumber")}, nil
+}
+
+// Raw returns the value as written, before rendering.
+func (t ValueTemplate) Raw() string {
+	return t.raw
+}
+
+// Render substitutes vars and requestNumber into the template.
+func (t ValueTemplate) Render(vars map[string]string, requestNumber int) (string, error) {
+	if t.tmpl == nil {
+		return t.raw, nil
+	}
+
+	// The request number differs per request, so it is bound on a copy of the template
+	tmpl := t.tmpl
+	if t.usesRequestNumber {
+		var err error
+		if tmpl, err = t.tmpl.Clone(); err != nil {
+			return "", err
+		}
+		tmpl.Funcs(template.FuncMap{"requestNumber": func() int { return requestNumber }})
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+const randStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// TemplateFuncs returns the built-in generators request templates can call:
+//
+//	randInt MIN MAX   random integer between MIN and MAX inclusive
+//	randString N      random alphanumeric string of length N
+//	uuid              random UUID
+//	timestamp         current Unix time in milliseconds
+//	now               current time in RFC 3339 format
+//	seq [NAME]        next value of a counter starting at 1, one per NAME
+//	nodeID            ID of the driver node sending the request
+//	requestNumber     number of the request within the test
+//
+// Counters are shared by every template built from the same FuncMap.
+func TemplateFuncs(nodeID string) template.FuncMap {
+	var mu sync.Mutex
+	counters := make(map[string]*int64)
+
+	return template.FuncMap{
+		"randInt": func(min, max int) int {
+			if max <= min {
+				return min
+			}
+			return min + rand.Intn(max-min+1)
+		},
+		"randString": func(n int) string {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = randStringLetters[rand.Intn(len(randStringLetters))]
+			}
+			return string(b)
+		},
+		"uuid": func() string {
+			return uuid.New().String()
+		},
+		"timestamp": func() int64 {
+			return time.Now().UnixMilli()
+		},
+		"now": func() string {
+			return time.Now().UTC().Format(time.RFC3339)
+		},
+		"seq": func(names ...string) int64 {
+			name := strings.Join(names, ".")
+			mu.Lock()
+			counter, ok := counters[name]
+			if !ok {
+				counter = new(int64)
+				counters[name] = counter
+			}
+			mu.Unlock()
+			return atomic.AddInt64(counter, 1)
+		},
+		"nodeID": func() string {
+			return nodeID
+		},
+		// Placeholder so templates parse, Render binds the actual number
+		"requestNumber": func() int {
+			return 0
+		},
+	}
+}
@@ -0,0 +1,207 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// abortCondition is a condition on a test's live results, such as
+// "error_rate > 20% for 30s", that aborts the test once it has held for
+// holdFor.
+type abortCondition struct {
+	threshold
+	holdFor time.Duration
+}
+
+var abortForPattern = regexp.MustCompile(`^(.*\S)\s+for\s+(\S+)\s*$`)
+
+// parseAbortCondition parses an abort condition of the form
+// "<metric> <op> <value> [for <duration>]". The metric and value are those
+// of thresholds. Without a duration the test is aborted as soon as one
+// window meets the condition.
+func parseAbortCondition(raw string) (abortCondition, error) {
+	condition, holdFor := raw, time.Duration(0)
+	if match := abortForPattern.FindStringSubmatch(raw); match != nil {
+		d, err := time.ParseDuration(match[2])
+		if err != nil || d < 0 {
+			return abortCondition{}, fmt.Errorf("abort condition %q: for needs a duration such as 30s", raw)
+		}
+		condition, holdFor = match[1], d
+	}
+
+	t, err := parseThreshold(condition)
+	if err != nil {
+		return abortCondition{}, fmt.Errorf("abort condition %q: %v", raw, err)
+	}
+	t.raw = raw
+	return abortCondition{threshold: t, holdFor: holdFor}, nil
+}
+
+// Abort records why the orchestrator aborted a test.
+type Abort struct {
+	TestID    string `json:"test_id"`
+	Condition string `json:"condition"`
+	Actual    string `json:"actual,omitempty"`
+	AbortedAt string `json:"aborted_at"`
+}
+
+// reason describes why the test was aborted.
+func (a Abort) reason() string {
+	if a.Actual == "" {
+		return a.Condition
+	}
+	return a.Condition + " (actual " + a.Actual + ")"
+}
+
+// abortWatch is the live state of a test with abort conditions.
+type abortWatch struct {
+	conditions    []abortCondition
+	windows       map[string]kafka.MetricsMessage // latest window of each node
+	breachedSince map[string]time.Time            // when each condition started holding
+	aborted       bool
+}
+
+// watchAbortConditions evaluates the abort conditions of the test of window
+// against the latest window of each of its drivers, and aborts the test when
+// one has held for its duration. The caller must hold o.mu.
+func (o *Orchestrator) watchAbortConditions(window kafka.MetricsMessage) error {
+	watch := o.abortWatches[window.TestID]
+	if watch == nil {
+		// Tests not triggered by this orchestrator have no conditions to
+		// watch, and finished tests have nothing left to abort
+		test, err := o.test(window.TestID)
+		if err == badger.ErrKeyNotFound || (err == nil && test.Finished()) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		testConfig, err := o.testConfig(window.TestID)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		watch = &abortWatch{
+			windows:       make(map[string]kafka.MetricsMessage),
+			breachedSince: make(map[string]time.Time),
+		}
+		for _, raw := range testConfig.AbortOn {
+			condition, err := parseAbortCondition(raw)
+			if err != nil {
+				return err
+			}
+			watch.conditions = append(watch.conditions, condition)
+		}
+		o.abortWatches[window.TestID] = watch
+	}
+	if watch.aborted || len(watch.conditions) == 0 {
+		return nil
+	}
+	if window.Paused {
+		// Requests were held back on purpose, start judging afresh on resume
+		watch.breachedSince = make(map[string]time.Time)
+		delete(watch.windows, window.NodeID)
+		return nil
+	}
+	watch.windows[window.NodeID] = window
+
+	// The windows cover the same span on every driver, so their RPS add up
+	windows := make([]kafka.MetricsMessage, 0, len(watch.windows))
+	rps := 0.0
+	for _, w := range watch.windows {
+		windows = append(windows, w)
+		rps += w.RPS
+	}
+	summary := summarizeMetrics(window.TestID, windows)
+	summary.RPS = rps
+
+	now := time.Now()
+	for _, condition := range watch.conditions {
+		actual := condition.actual(summary)
+		if !condition.holds(actual) {
+			delete(watch.breachedSince, condition.raw)
+			continue
+		}
+		since, ok := watch.breachedSince[condition.raw]
+		if !ok {
+			since = now
+			watch.breachedSince[condition.raw] = now
+		}
+		if now.Sub(since) >= condition.holdFor {
+			watch.aborted = true
+			return o.abortTest(Abort{
+				TestID:    window.TestID,
+				Condition: condition.raw,
+				Actual:    condition.formatActual(actual),
+				AbortedAt: now.Format(time.RFC3339),
+			})
+		}
+	}
+	return nil
+}
+
+// abortTest tells the drivers of a test to stop and records why. A test that
+// was not armed yet is only marked aborted, so that it is never triggered.
+// The caller must hold o.mu.
+func (o *Orchestrator) abortTest(abort Abort) error {
+	// Nothing is sent or recorded for a test that cannot be aborted
+	started := true
+	test, err := o.test(abort.TestID)
+	switch {
+	case err == badger.ErrKeyNotFound:
+		// Triggered before tests had a lifecycle
+	case err != nil:
+		return err
+	default:
+		if err := checkTransition(test, TestAborted); err != nil {
+			return err
+		}
+		started = test.State != TestCreated && test.State != TestConfigured
+	}
+
+	fmt.Printf("Aborting test %s: %s\n", abort.TestID, abort.reason())
+
+	if started {
+		if err := o.sendControl(abort.TestID, kafka.TriggerAbort); err != nil {
+			return err
+		}
+	}
+
+	abortJSON, err := json.Marshal(abort)
+	if err != nil {
+		return err
+	}
+	err = o.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("abort:"+abort.TestID), abortJSON)
+	})
+	if err != nil {
+		return err
+	}
+	if err := o.transitionTest(abort.TestID, TestAborted, abort.reason()); err != nil {
+		return err
+	}
+	_, err = o.updateVerdict(abort.TestID)
+	return err
+}
+
+// abort returns why testID was aborted.
+func (o *Orchestrator) abort(testID string) (Abort, error) {
+	var abort Abort
+	err := o.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("abort:" + testID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &abort)
+		})
+	})
+	return abort, err
+}
@@ -0,0 +1,124 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// errUnknownTest is returned when controlling a test this orchestrator did
+// not trigger.
+var errUnknownTest = errors.New("no test with this id was triggered")
+
+// sendControl sends trigger to the drivers running testID.
+func (o *Orchestrator) sendControl(testID string, trigger string) error {
+	trigMessage := kafka.TriggerMessage{
+		TestID:  testID,
+		Trigger: trigger,
+	}
+	_, terrors := o.triggerProducer.ProduceTriggerMessages("trigger-topic", []kafka.TriggerMessage{trigMessage})
+	if terrors != 0 {
+		return fmt.Errorf("error producing %s message: %v", trigger, terrors)
+	}
+	return nil
+}
+
+// errTestNotStarted is returned when pausing or resuming a test that was not
+// armed yet.
+var errTestNotStarted = errors.New("test has not started yet")
+
+// checkTest returns errUnknownTest if testID was not triggered by this
+// orchestrator and errTestFinished if it is over. It reports whether the
+// test was armed, and so may be running on drivers.
+func (o *Orchestrator) checkTest(testID string) (bool, error) {
+	test, err := o.test(testID)
+	if err == nil {
+		if test.Finished() {
+			return false, errTestFinished
+		}
+		return test.State != TestCreated && test.State != TestConfigured, nil
+	}
+	if err != badger.ErrKeyNotFound {
+		return false, err
+	}
+
+	// Triggered before tests had a lifecycle
+	_, err = o.testConfig(testID)
+	if err == badger.ErrKeyNotFound {
+		return false, errUnknownTest
+	}
+	return err == nil, err
+}
+
+// StopTest tells the drivers of testID to stop it. A stop lets requests in
+// flight drain, an abort cancels them and fails the test. A test stopped
+// before it was armed is aborted without ever starting.
+func (o *Orchestrator) StopTest(testID string, abort bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	started, err := o.checkTest(testID)
+	if err != nil {
+		return err
+	}
+
+	// Drivers only start a test once it is armed, aborting it first keeps
+	// it from ever being triggered
+	if !started {
+		return o.abortTest(Abort{
+			TestID:    testID,
+			Condition: "stopped before it started",
+			AbortedAt: time.Now().Format(time.RFC3339),
+		})
+	}
+
+	if abort {
+		return o.abortTest(Abort{
+			TestID:    testID,
+			Condition: "aborted on request",
+			AbortedAt: time.Now().Format(time.RFC3339),
+		})
+	}
+
+	fmt.Printf("Stopping test %s\n", testID)
+	return o.sendControl(testID, kafka.TriggerStop)
+}
+
+// PauseTest tells the drivers of testID to stop sending requests until the
+// test is resumed. Metrics and stage progress are kept.
+func (o *Orchestrator) PauseTest(testID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	started, err := o.checkTest(testID)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return errTestNotStarted
+	}
+
+	fmt.Printf("Pausing test %s\n", testID)
+	return o.sendControl(testID, kafka.TriggerPause)
+}
+
+// ResumeTest tells the drivers of testID to resume sending requests where
+// they were paused.
+func (o *Orchestrator) ResumeTest(testID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	started, err := o.checkTest(testID)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return errTestNotStarted
+	}
+
+	fmt.Printf("Resuming test %s\n", testID)
+	return o.sendControl(testID, kafka.TriggerResume)
+}
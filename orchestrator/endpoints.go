@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"github.com/ankush-003/distributed-load-testing/kafka"
@@ -10,7 +11,9 @@ import (
 
 
 type MetricsResponse struct {
-	Metrics []kafka.MetricsMessage `json:"metrics"`
+	Metrics []kafka.MetricsMessage       `json:"metrics"`
+	Total   kafka.MetricsData            `json:"total"`            // metrics of all nodes' requests, from their merged histograms
+	Checks  map[string]kafka.CheckResult `json:"checks,omitempty"` // pass and fail counts per check across all nodes
 }
 
 // RetrieveAllNodesEndpoint retrieves all registered nodes.
@@ -43,10 +46,30 @@ func RetrieveAllNodesEndpoint(c *gin.Context, db *badger.DB) {
 
 func TriggerLoadTestEndpoint(c *gin.Context, orchestrator *Orchestrator) {
 	var requestData struct {
-		TestType              string `json:"test_type" binding:"required"`
-		TestServer             string `json:"test_server"`
-		TestMessageDelay      int    `json:"test_message_delay" binding:"required"`
-		MessageCountPerDriver int    `json:"message_count_per_driver" binding:"required"`
+		TestType              string                     `json:"test_type" binding:"required"`
+		TestServer            string                     `json:"test_server"`
+		TestMessageDelay      int                        `json:"test_message_delay"`
+		MessageCountPerDriver int                        `json:"message_count_per_driver"`
+		RampStartRPS          float64                    `json:"ramp_start_rps"`
+		RampTargetRPS         float64                    `json:"ramp_target_rps"`
+		RampDurationSeconds   int                        `json:"ramp_duration_seconds"`
+		HoldDurationSeconds   int                        `json:"hold_duration_seconds"`
+		Stages                []kafka.Stage              `json:"stages"`
+		ArrivalRate           float64                    `json:"arrival_rate"`
+		MaxInFlight           int                        `json:"max_in_flight"`
+		VirtualUsers          int                        `json:"virtual_users"`
+		IterationsPerUser     int                        `json:"iterations_per_user"`
+		DurationSeconds       int                        `json:"duration_seconds"`
+		ThinkTime             *kafka.ThinkTime           `json:"think_time"`
+		GracefulDrainSeconds  int                        `json:"graceful_drain_seconds"`
+		Arrival               *kafka.ArrivalDistribution `json:"arrival"`
+		Request               *kafka.RequestSpec         `json:"request"`
+		Requests              []kafka.RequestSpec        `json:"requests"`
+		Steps                 []kafka.RequestSpec        `json:"steps"`
+		DataFeed              *kafka.DataFeed            `json:"data_feed"`
+		MetricsIntervalMs     int                        `json:"metrics_interval_ms"`
+		Thresholds            []string                   `json:"thresholds"`
+		AbortOn               []string                   `json:"abort_on"`
 	}
 
 	// Bind JSON request body to the struct
@@ -55,10 +78,65 @@ func TriggerLoadTestEndpoint(c *gin.Context, orchestrator *Orchestrator) {
 		return
 	}
 
+	testConfig := kafka.TestConfigMessage{
+		TestType:              requestData.TestType,
+		TestServer:            requestData.TestServer,
+		TestMessageDelay:      requestData.TestMessageDelay,
+		MessageCountPerDriver: requestData.MessageCountPerDriver,
+		RampStartRPS:          requestData.RampStartRPS,
+		RampTargetRPS:         requestData.RampTargetRPS,
+		RampDurationSeconds:   requestData.RampDurationSeconds,
+		HoldDurationSeconds:   requestData.HoldDurationSeconds,
+		Stages:                requestData.Stages,
+		ArrivalRate:           requestData.ArrivalRate,
+		MaxInFlight:           requestData.MaxInFlight,
+		VirtualUsers:          requestData.VirtualUsers,
+		IterationsPerUser:     requestData.IterationsPerUser,
+		DurationSeconds:       requestData.DurationSeconds,
+		ThinkTime:             requestData.ThinkTime,
+		GracefulDrainSeconds:  requestData.GracefulDrainSeconds,
+		Arrival:               requestData.Arrival,
+		Request:               requestData.Request,
+		Requests:              requestData.Requests,
+		Steps:                 requestData.Steps,
+		DataFeed:              requestData.DataFeed,
+		MetricsIntervalMs:     requestData.MetricsIntervalMs,
+		Thresholds:            requestData.Thresholds,
+		AbortOn:               requestData.AbortOn,
+	}
+
+	// Reject configs that are missing parameters for their test type
+	if err := validateTestConfig(testConfig, orchestrator.heartbeatTimeout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Split unique data feed rows across the live drivers
+	if err := orchestrator.partitionDataFeed(testConfig.DataFeed); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTestConfigSize(testConfig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Trigger the load test with the provided parameters
-	orchestrator.TriggerLoadTestFromAPI(requestData.TestType,requestData.TestServer, requestData.TestMessageDelay, requestData.MessageCountPerDriver)
+	testID, err := orchestrator.TriggerLoadTestFromAPI(testConfig)
+	if errors.Is(err, errTestInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err == errTestFinished {
+		c.JSON(http.StatusConflict, gin.H{"error": "test was aborted before it started", "test_id": testID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "test_id": testID})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Load test triggered successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Load test triggered successfully", "test_id": testID})
 }
 
 
@@ -78,7 +156,8 @@ func RetrieveMetricsForNodeEndpoint(c *gin.Context, db *badger.DB) {
 			return err
 		}
 
-		err = json.Unmarshal(val, &retrievedMetrics)
+		// Metrics stored before the current format are upgraded on the way out
+		retrievedMetrics, err = kafka.DecodeMetricsMessage(val)
 		return err
 	})
 
@@ -115,8 +194,7 @@ func RetrieveAllMetricsEndpoint(c *gin.Context, orchestrator *Orchestrator) {
 				return err
 			}
 
-			var metrics kafka.MetricsMessage
-			err = json.Unmarshal(val, &metrics)
+			metrics, err := kafka.DecodeMetricsMessage(val)
 			if err != nil {
 				return err
 			}
@@ -134,11 +212,31 @@ func RetrieveAllMetricsEndpoint(c *gin.Context, orchestrator *Orchestrator) {
 	// Create a response containing all metrics
 	response := MetricsResponse{
 		Metrics: allMetrics,
+		Checks:  sumChecks(allMetrics),
+	}
+	for _, metrics := range allMetrics {
+		response.Total.Merge(metrics.Metrics)
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// sumChecks adds up the check pass and fail counts reported by each node.
+func sumChecks(allMetrics []kafka.MetricsMessage) map[string]kafka.CheckResult {
+	var checks map[string]kafka.CheckResult
+	for _, metrics := range allMetrics {
+		for name, result := range metrics.Checks {
+			if checks == nil {
+				checks = make(map[string]kafka.CheckResult)
+			}
+			total := checks[name]
+			total.Passes += result.Passes
+			total.Fails += result.Fails
+			checks[name] = total
+		}
+	}
+	return checks
+}
 
 func RetrieveHeartbeatEndpoint(c *gin.Context, db *badger.DB) {
 	nodeID := c.Param("nodeid")
@@ -196,6 +294,134 @@ func RetrieveTestConfigEndpoint(c *gin.Context, db *badger.DB) {
 	c.JSON(http.StatusOK, retrievedMessages)
 }
 
+// RetrieveTestSummaryEndpoint retrieves the metrics of all nodes in a test
+// aggregated into one summary.
+func RetrieveTestSummaryEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	testID := c.Param("id")
+
+	summary, err := orchestrator.testSummary(testID)
+	if err == errNoMetrics {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// RetrieveTestTimeSeriesEndpoint retrieves the windowed metrics of a test.
+func RetrieveTestTimeSeriesEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	testID := c.Param("id")
+
+	series, err := orchestrator.testTimeSeries(testID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(series.Nodes) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": errNoMetrics.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// RetrieveTestVerdictEndpoint retrieves whether a test met its thresholds.
+func RetrieveTestVerdictEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	testID := c.Param("id")
+
+	verdict, err := orchestrator.verdict(testID)
+	if err == badger.ErrKeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no verdict for test, no driver has finished it yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, verdict)
+}
+
+// StopTestEndpoint stops a running test. Requests in flight are given the
+// test's graceful drain to finish, or cancelled at once with mode=abort.
+func StopTestEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	mode := c.DefaultQuery("mode", "stop")
+	if mode != "stop" && mode != "abort" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be stop or abort"})
+		return
+	}
+
+	stop := func(testID string) error {
+		return orchestrator.StopTest(testID, mode == "abort")
+	}
+	controlTestEndpoint(c, stop, "Test "+mode+" requested")
+}
+
+// PauseTestEndpoint suspends request generation of a running test.
+func PauseTestEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	controlTestEndpoint(c, orchestrator.PauseTest, "Test pause requested")
+}
+
+// ResumeTestEndpoint resumes request generation of a paused test.
+func ResumeTestEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	controlTestEndpoint(c, orchestrator.ResumeTest, "Test resume requested")
+}
+
+// controlTestEndpoint applies control to the test in the path.
+func controlTestEndpoint(c *gin.Context, control func(testID string) error, message string) {
+	testID := c.Param("id")
+
+	err := control(testID)
+	if err == errUnknownTest {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err == errTestFinished || err == errTestNotStarted {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message, "test_id": testID})
+}
+
+// RetrieveTestsEndpoint retrieves every test triggered through the
+// orchestrator with its state, most recent first.
+func RetrieveTestsEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	tests, err := orchestrator.tests()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tests)
+}
+
+// RetrieveTestEndpoint retrieves the state of a test and when it entered
+// each state.
+func RetrieveTestEndpoint(c *gin.Context, orchestrator *Orchestrator) {
+	testID := c.Param("id")
+
+	test, err := orchestrator.test(testID)
+	if err == badger.ErrKeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUnknownTest.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, test)
+}
+
 // SetupHTTPHandlers configures the HTTP routes.
 func (o *Orchestrator) SetupHTTPHandlers(router *gin.Engine) {
 	router.GET("/all-nodes", func(c *gin.Context) {
@@ -218,6 +444,38 @@ func (o *Orchestrator) SetupHTTPHandlers(router *gin.Engine) {
 		RetrieveAllMetricsEndpoint(c, o)
 	})
 
+	router.GET("/tests", func(c *gin.Context) {
+		RetrieveTestsEndpoint(c, o)
+	})
+
+	router.GET("/tests/:id", func(c *gin.Context) {
+		RetrieveTestEndpoint(c, o)
+	})
+
+	router.GET("/tests/:id/summary", func(c *gin.Context) {
+		RetrieveTestSummaryEndpoint(c, o)
+	})
+
+	router.GET("/tests/:id/timeseries", func(c *gin.Context) {
+		RetrieveTestTimeSeriesEndpoint(c, o)
+	})
+
+	router.GET("/tests/:id/verdict", func(c *gin.Context) {
+		RetrieveTestVerdictEndpoint(c, o)
+	})
+
+	router.POST("/tests/:id/stop", func(c *gin.Context) {
+		StopTestEndpoint(c, o)
+	})
+
+	router.POST("/tests/:id/pause", func(c *gin.Context) {
+		PauseTestEndpoint(c, o)
+	})
+
+	router.POST("/tests/:id/resume", func(c *gin.Context) {
+		ResumeTestEndpoint(c, o)
+	})
+
 	router.GET("/heartbeat/:nodeid", func(c *gin.Context) {
 		RetrieveHeartbeatEndpoint(c, o.db)
 	})
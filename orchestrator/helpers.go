@@ -2,9 +2,11 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	// "os"
+	"sort"
 	"time"
 	"sync"
 	"github.com/dgraph-io/badger/v3"
@@ -22,6 +24,8 @@ type Orchestrator struct {
 	triggerProducer    *kafka.Producer
 	db                *badger.DB
 	heartbeatTimeout  time.Duration
+	abortWatches      map[string]*abortWatch
+	testActivity      map[string]time.Time // when each unfinished test was created, armed or last reported on
 }
 
 
@@ -36,6 +40,8 @@ func NewOrchestrator(heartbeatConsumer *kafka.Consumer, metricsConsumer *kafka.C
 		triggerProducer:    triggerProducer,
 		db:                db,
 		heartbeatTimeout:  heartbeatTimeout,
+		abortWatches:      make(map[string]*abortWatch),
+		testActivity:      make(map[string]time.Time),
 	}
 }
 
@@ -116,8 +122,25 @@ func (o *Orchestrator) handleMetrics(metrics kafka.MetricsMessage) {
 
 	
 
+	// Windows are kept as a time series and added up into the node's totals
+	// for the test, version 1 snapshots already are totals
+	totals := metrics
+	if metrics.Sequence > 0 && metrics.TestID != "" {
+		if err := o.storeMetricsWindow(metrics); err != nil {
+			log.Fatal(err)
+		}
+		previous, err := o.nodeTestMetrics(metrics.TestID, metrics.NodeID)
+		if err != nil && err != badger.ErrKeyNotFound {
+			log.Fatal(err)
+		}
+		if err == nil {
+			previous.Merge(metrics)
+			totals = previous
+		}
+	}
+
 	// Marshal the MetricsMessage into a JSON-encoded byte slice
-	metricsMessageJSON, err := json.Marshal(metrics)
+	metricsMessageJSON, err := json.Marshal(totals)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -126,11 +149,39 @@ func (o *Orchestrator) handleMetrics(metrics kafka.MetricsMessage) {
 	err = o.db.Update(func(txn *badger.Txn) error {
 		key := []byte("metrics:" + metrics.NodeID)
 		err := txn.Set(key, metricsMessageJSON)
-		return err
+		if err != nil || metrics.TestID == "" {
+			return err
+		}
+		// Keep each node's totals per test to aggregate test summaries
+		testKey := []byte("metrics:" + metrics.TestID + ":" + metrics.NodeID)
+		return txn.Set(testKey, metricsMessageJSON)
 	})
 	if err != nil {
 		log.Fatal(err)
-	}		
+	}
+
+	if metrics.TestID != "" {
+		if err := o.testReported(metrics.TestID); err != nil {
+			fmt.Printf("Error updating state of test %s: %v\n", metrics.TestID, err)
+		}
+	}
+
+	// Abort the test if its live results breach an abort condition
+	if metrics.Sequence > 0 && metrics.TestID != "" {
+		if err := o.watchAbortConditions(metrics); err != nil {
+			fmt.Printf("Error evaluating abort conditions of test %s: %v\n", metrics.TestID, err)
+		}
+	}
+
+	// A driver finished, judge the test on the results so far
+	if metrics.Final && metrics.TestID != "" {
+		verdict, err := o.updateVerdict(metrics.TestID)
+		if err != nil {
+			fmt.Printf("Error evaluating thresholds of test %s: %v\n", metrics.TestID, err)
+		} else if err := o.concludeTest(metrics.TestID, verdict); err != nil {
+			fmt.Printf("Error updating state of test %s: %v\n", metrics.TestID, err)
+		}
+	}
 }
 
 func (o *Orchestrator) handleRegister(register kafka.RegisterMessage) {
@@ -274,54 +325,144 @@ func (o *Orchestrator) logHeartbeatToBadger(heartbeat kafka.HeartbeatMessage) er
 }
 
 
-func (o *Orchestrator) TriggerLoadTestFromAPI(testType string,TestServer string, testMessageDelay, messageCountPerDriver int) {
+// liveDriverNodes returns the registered driver nodes heard from within the
+// heartbeat timeout, sorted. The caller must hold o.mu.
+func (o *Orchestrator) liveDriverNodes() []string {
+	nodeIDs := make([]string, 0, len(o.driverNodes))
+	for nodeID, lastSeen := range o.driverNodes {
+		if o.heartbeatTimeout > 0 && time.Since(lastSeen) > o.heartbeatTimeout {
+			continue
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs
+}
+
+// partitionDataFeed assigns the rows of a unique data feed round-robin to
+// the live driver nodes, so that no two drivers use the same row and no rows
+// are left to drivers that will not run the test.
+func (o *Orchestrator) partitionDataFeed(feed *kafka.DataFeed) error {
+	if feed == nil || feed.Mode != "unique" {
+		return nil
+	}
+
+	o.mu.Lock()
+	nodeIDs := o.liveDriverNodes()
+	o.mu.Unlock()
+
+	if len(nodeIDs) == 0 {
+		return fmt.Errorf("no live driver nodes to partition the data feed across")
+	}
+
+	rows, err := feed.Rows()
+	if err != nil {
+		return err
+	}
+
+	feed.Partitions = make(map[string][]int, len(nodeIDs))
+	for i := range rows {
+		nodeID := nodeIDs[i%len(nodeIDs)]
+		feed.Partitions[nodeID] = append(feed.Partitions[nodeID], i)
+	}
+	return nil
+}
+
+// errTestInProgress is returned when triggering a test while another one has
+// not finished. Drivers run one test at a time and would only read the new
+// one's config and trigger once done with the current one, long after the
+// new test was taken for stalled.
+var errTestInProgress = errors.New("another test is in progress")
+
+// TriggerLoadTestFromAPI sends testConfig to the drivers, triggers the test
+// and returns its ID. The test is recorded as failed if it cannot be sent.
+func (o *Orchestrator) TriggerLoadTestFromAPI(testConfig kafka.TestConfigMessage) (string, error) {
 	// Additional logic to determine when to trigger the load test.
 	// For now, trigger the test immediately.
 
 	// Generating a random test id
 	testID := uuid.New().String()
+	testConfig.TestID = testID
 
-	testConfigMessages := []kafka.TestConfigMessage{{
-		TestID:                testID,
-		TestType:              testType,
-		TestServer: TestServer,
-		TestMessageDelay:      testMessageDelay,
-		MessageCountPerDriver: messageCountPerDriver,
-	}}
+	o.mu.Lock()
+	for busyID := range o.testActivity {
+		o.mu.Unlock()
+		return "", fmt.Errorf("%w: test %s", errTestInProgress, busyID)
+	}
+	err := o.createTest(testID, testConfig.TestType)
+	o.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	fail := func(err error) (string, error) {
+		if err := o.moveTest(testID, TestFailed, err.Error()); err != nil {
+			fmt.Printf("Error updating state of test %s: %v\n", testID, err)
+		}
+		return testID, err
+	}
+
+	testConfigMessages := []kafka.TestConfigMessage{testConfig}
 
 	_, errors := o.testConfigProducer.ProduceTestConfigMessages("test-config-topic", testConfigMessages)
 
 	if errors != 0 {
-		log.Fatalf("Error producing test config message: %v", errors)
+		return fail(fmt.Errorf("error producing test config message: %v", errors))
 	}
 
 	// Storing test config data in BadgerDB
 	testConfigMessagesJSON, err := json.Marshal(testConfigMessages)
 	if err != nil {
-		log.Fatal(err)
+		return fail(err)
+	}
+
+	testConfigJSON, err := json.Marshal(testConfig)
+	if err != nil {
+		return fail(err)
 	}
 
 	// Set the byte slice as the value for a key in the BadgerDB instance.
 	err = o.db.Update(func(txn *badger.Txn) error {
 		err := txn.Set([]byte("testConfigMessages"), testConfigMessagesJSON)
-		return err
+		if err != nil {
+			return err
+		}
+		// Keep every test's config to evaluate its thresholds
+		return txn.Set([]byte("testconfig:"+testID), testConfigJSON)
 	})
 	if err != nil {
-		log.Fatal(err)
+		return fail(err)
+	}
+	if err := o.moveTest(testID, TestConfigured, ""); err != nil {
+		return testID, err
 	}
 
 	// added due to processing delay between test config and trigger at driver node
 	time.Sleep(5 * time.Second)
 
+	// Armed before the trigger goes out, drivers may report right after it.
+	// A test aborted in the meantime is not started.
+	if err := o.moveTest(testID, TestArmed, ""); err != nil {
+		return testID, err
+	}
+
 	// Trigger message
 	trigMessage := kafka.TriggerMessage{
 		TestID:  testID,
-		Trigger: "YES",
+		Trigger: kafka.TriggerStart,
 	}
 
 	_, terrors := o.triggerProducer.ProduceTriggerMessages("trigger-topic", []kafka.TriggerMessage{trigMessage})
 
 	if terrors != 0 {
-		log.Fatalf("Error producing trigger message: %v", terrors)
+		return fail(fmt.Errorf("error producing trigger message: %v", terrors))
 	}
+	return testID, nil
+}
+
+// moveTest moves testID to state like transitionTest, locking o.mu.
+func (o *Orchestrator) moveTest(testID string, state TestState, reason string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.transitionTest(testID, state, reason)
 }
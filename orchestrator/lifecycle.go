@@ -0,0 +1,279 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// errTestFinished is returned when changing a test that already completed,
+// failed or was aborted.
+var errTestFinished = errors.New("test already finished")
+
+// TestState is where a test is in its lifecycle.
+type TestState string
+
+const (
+	TestCreated    TestState = "created"    // an id was assigned, nothing was sent yet
+	TestConfigured TestState = "configured" // the config was sent to the drivers
+	TestArmed      TestState = "armed"      // the trigger is sent, no driver has reported yet
+	TestRunning    TestState = "running"    // drivers are reporting metrics
+	TestCompleted  TestState = "completed"  // every driver finished and the thresholds held
+	TestAborted    TestState = "aborted"    // the test was aborted on request or by an abort condition
+	TestFailed     TestState = "failed"     // the test could not be run, or its thresholds failed
+)
+
+// testTransitions lists the states each state can move to. Completed,
+// aborted and failed tests are final.
+var testTransitions = map[TestState][]TestState{
+	TestCreated:    {TestConfigured, TestAborted, TestFailed},
+	TestConfigured: {TestArmed, TestAborted, TestFailed},
+	TestArmed:      {TestRunning, TestCompleted, TestAborted, TestFailed},
+	TestRunning:    {TestCompleted, TestAborted, TestFailed},
+}
+
+// Test is a load test triggered through the orchestrator, persisted under
+// test:<id>.
+type Test struct {
+	TestID      string           `json:"test_id"`
+	TestType    string           `json:"test_type"`
+	State       TestState        `json:"state"`
+	Reason      string           `json:"reason,omitempty"` // why the test failed or was aborted
+	Transitions []TestTransition `json:"transitions"`
+}
+
+// TestTransition records when a test entered a state.
+type TestTransition struct {
+	State TestState `json:"state"`
+	At    string    `json:"at"`
+}
+
+// Finished reports whether the test reached a final state.
+func (t Test) Finished() bool {
+	_, ok := testTransitions[t.State]
+	return !ok
+}
+
+// createTest stores a new test in the created state. The caller must hold
+// o.mu.
+func (o *Orchestrator) createTest(testID string, testType string) error {
+	test := Test{
+		TestID:   testID,
+		TestType: testType,
+		State:    TestCreated,
+		Transitions: []TestTransition{
+			{State: TestCreated, At: time.Now().Format(time.RFC3339)},
+		},
+	}
+	if err := o.storeTest(test); err != nil {
+		return err
+	}
+	o.testActivity[testID] = time.Now()
+	return nil
+}
+
+// transitionTest moves testID to state, recording reason when the test fails
+// or is aborted. Moving a test to the state it is in does nothing, and tests
+// this orchestrator did not create are ignored. The caller must hold o.mu.
+func (o *Orchestrator) transitionTest(testID string, state TestState, reason string) error {
+	test, err := o.test(testID)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if test.State == state {
+		return nil
+	}
+	if err := checkTransition(test, state); err != nil {
+		return err
+	}
+
+	test.State = state
+	if reason != "" {
+		test.Reason = reason
+	}
+	test.Transitions = append(test.Transitions, TestTransition{State: state, At: time.Now().Format(time.RFC3339)})
+	if err := o.storeTest(test); err != nil {
+		return err
+	}
+	switch {
+	case test.Finished():
+		// Nothing left to abort or wait for
+		delete(o.abortWatches, testID)
+		delete(o.testActivity, testID)
+	case state == TestArmed:
+		o.testActivity[testID] = time.Now()
+	}
+	return nil
+}
+
+// checkTransition returns errTestFinished if test is over, and an error if
+// it cannot move to state otherwise.
+func checkTransition(test Test, state TestState) error {
+	if test.Finished() {
+		return errTestFinished
+	}
+	for _, next := range testTransitions[test.State] {
+		if next == state {
+			return nil
+		}
+	}
+	return fmt.Errorf("test %s cannot go from %s to %s", test.TestID, test.State, state)
+}
+
+// testReported notes that metrics arrived for testID, moving it to running
+// when they are the first. The caller must hold o.mu.
+func (o *Orchestrator) testReported(testID string) error {
+	test, err := o.test(testID)
+	if err == badger.ErrKeyNotFound || (err == nil && test.Finished()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	o.testActivity[testID] = time.Now()
+	if test.State != TestArmed {
+		return nil
+	}
+	return o.transitionTest(testID, TestRunning, "")
+}
+
+// RunTestTimeouts fails unfinished tests no driver has reported on for the
+// heartbeat timeout, so that a driver dying mid-test does not leave its test
+// running, and keeping new tests from being triggered, forever.
+func (o *Orchestrator) RunTestTimeouts() {
+	if o.heartbeatTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(o.heartbeatTimeout / 10)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		o.mu.Lock()
+		o.failStalledTests(now)
+		o.mu.Unlock()
+	}
+}
+
+// failStalledTests fails the tests last reported on more than the heartbeat
+// timeout before now. The caller must hold o.mu.
+func (o *Orchestrator) failStalledTests(now time.Time) {
+	for testID, last := range o.testActivity {
+		if now.Sub(last) < o.heartbeatTimeout {
+			continue
+		}
+
+		reason := fmt.Sprintf("no driver reported for %s", o.heartbeatTimeout)
+		if waiting := o.unfinishedDrivers(testID); len(waiting) > 0 {
+			reason = fmt.Sprintf("drivers %s did not finish, no driver reported for %s", strings.Join(waiting, ", "), o.heartbeatTimeout)
+		}
+		fmt.Printf("Failing test %s: %s\n", testID, reason)
+		if err := o.transitionTest(testID, TestFailed, reason); err != nil {
+			fmt.Printf("Error updating state of test %s: %v\n", testID, err)
+			delete(o.testActivity, testID)
+		}
+	}
+}
+
+// unfinishedDrivers returns the drivers that reported on testID but not its
+// last window, sorted.
+func (o *Orchestrator) unfinishedDrivers(testID string) []string {
+	allMetrics, err := o.testMetrics(testID)
+	if err != nil {
+		return nil
+	}
+	var nodeIDs []string
+	for _, metrics := range allMetrics {
+		if !metrics.Final {
+			nodeIDs = append(nodeIDs, metrics.NodeID)
+		}
+	}
+	sort.Strings(nodeIDs)
+	return nodeIDs
+}
+
+// concludeTest moves testID to its final state once verdict is complete. The
+// caller must hold o.mu.
+func (o *Orchestrator) concludeTest(testID string, verdict Verdict) error {
+	if !verdict.Complete {
+		return nil
+	}
+	test, err := o.test(testID)
+	if err == badger.ErrKeyNotFound || (err == nil && test.Finished()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if verdict.Aborted {
+		return o.transitionTest(testID, TestAborted, verdict.AbortReason)
+	}
+	if len(verdict.DriverErrors) > 0 {
+		return o.transitionTest(testID, TestFailed, "drivers failed: "+strings.Join(verdict.DriverErrors, ", "))
+	}
+	if !verdict.Passed {
+		return o.transitionTest(testID, TestFailed, "thresholds failed: "+strings.Join(verdict.Failed, ", "))
+	}
+	return o.transitionTest(testID, TestCompleted, "")
+}
+
+func (o *Orchestrator) storeTest(test Test) error {
+	testJSON, err := json.Marshal(test)
+	if err != nil {
+		return err
+	}
+	return o.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("test:"+test.TestID), testJSON)
+	})
+}
+
+// test returns the stored test testID.
+func (o *Orchestrator) test(testID string) (Test, error) {
+	var test Test
+	err := o.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("test:" + testID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &test)
+		})
+	})
+	return test, err
+}
+
+// tests returns every stored test, most recently created first.
+func (o *Orchestrator) tests() ([]Test, error) {
+	tests := []Test{}
+	err := o.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("test:")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var test Test
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &test)
+			})
+			if err != nil {
+				return err
+			}
+			tests = append(tests, test)
+		}
+		return nil
+	})
+	sort.SliceStable(tests, func(i, j int) bool {
+		return tests[i].Transitions[0].At > tests[j].Transitions[0].At
+	})
+	return tests, err
+}
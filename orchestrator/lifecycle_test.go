@@ -0,0 +1,274 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// newTestOrchestrator returns an orchestrator backed by an in-memory
+// database, without Kafka clients.
+func newTestOrchestrator(t *testing.T) *Orchestrator {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewOrchestrator(nil, nil, nil, nil, nil, time.Minute, db)
+}
+
+// storeTestConfig stores testConfig as if the orchestrator had triggered it.
+func storeTestConfig(t *testing.T, o *Orchestrator, testConfig kafka.TestConfigMessage) {
+	t.Helper()
+	testConfigJSON, err := json.Marshal(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("testconfig:"+testConfig.TestID), testConfigJSON)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFinishedTestsForgetAbortWatches(t *testing.T) {
+	o := newTestOrchestrator(t)
+	storeTestConfig(t, o, kafka.TestConfigMessage{TestID: "test", AbortOn: []string{"error_rate > 50%"}})
+	if err := o.createTest("test", "AVALANCHE"); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []TestState{TestConfigured, TestArmed, TestRunning} {
+		if err := o.transitionTest("test", state, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	window := kafka.MetricsMessage{TestID: "test", NodeID: "node", Metrics: kafka.MetricsData{Requests: 10}}
+	if err := o.watchAbortConditions(window); err != nil {
+		t.Fatal(err)
+	}
+	if o.abortWatches["test"] == nil {
+		t.Fatal("running test is not watched")
+	}
+
+	if err := o.transitionTest("test", TestCompleted, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.abortWatches["test"]; ok {
+		t.Error("completed test is still watched")
+	}
+
+	// Late windows must not bring the watch back
+	if err := o.watchAbortConditions(window); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.abortWatches["test"]; ok {
+		t.Error("late window of a completed test is watched")
+	}
+}
+
+func TestUnknownTestsAreNotWatched(t *testing.T) {
+	o := newTestOrchestrator(t)
+	if err := o.watchAbortConditions(kafka.MetricsMessage{TestID: "elsewhere", NodeID: "node"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.abortWatches) != 0 {
+		t.Errorf("watching %d tests, want none", len(o.abortWatches))
+	}
+}
+
+// armTest stores testID as triggered and armed.
+func armTest(t *testing.T, o *Orchestrator, testConfig kafka.TestConfigMessage) {
+	t.Helper()
+	storeTestConfig(t, o, testConfig)
+	if err := o.createTest(testConfig.TestID, testConfig.TestType); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []TestState{TestConfigured, TestArmed} {
+		if err := o.transitionTest(testConfig.TestID, state, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testState(t *testing.T, o *Orchestrator, testID string) Test {
+	t.Helper()
+	test, err := o.test(testID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return test
+}
+
+func TestCompletionIgnoresDriversThatNeverReported(t *testing.T) {
+	o := newTestOrchestrator(t)
+	for _, nodeID := range []string{"a", "b", "dead"} {
+		o.driverNodes[nodeID] = time.Now()
+	}
+	armTest(t, o, kafka.TestConfigMessage{TestID: "test", TestType: "AVALANCHE"})
+
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "a", Sequence: 1})
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "b", Sequence: 1})
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "a", Sequence: 2, Final: true})
+	if state := testState(t, o, "test").State; state != TestRunning {
+		t.Fatalf("test is %s with a driver still running, want running", state)
+	}
+
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "b", Sequence: 2, Final: true})
+	if state := testState(t, o, "test").State; state != TestCompleted {
+		t.Errorf("test is %s once its drivers finished, want completed", state)
+	}
+	if _, ok := o.testActivity["test"]; ok {
+		t.Error("completed test can still time out")
+	}
+}
+
+func TestDriverErrorFailsTest(t *testing.T) {
+	o := newTestOrchestrator(t)
+	o.driverNodes["a"] = time.Now()
+	armTest(t, o, kafka.TestConfigMessage{TestID: "test", TestType: "NOPE"})
+
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "a", Sequence: 1, Final: true, Error: `invalid test type "NOPE"`})
+	test := testState(t, o, "test")
+	if test.State != TestFailed {
+		t.Fatalf("test is %s, want failed", test.State)
+	}
+	if want := `drivers failed: a: invalid test type "NOPE"`; test.Reason != want {
+		t.Errorf("reason %q, want %q", test.Reason, want)
+	}
+}
+
+func TestStalledTestFails(t *testing.T) {
+	o := newTestOrchestrator(t)
+	o.driverNodes["a"] = time.Now()
+	o.driverNodes["b"] = time.Now()
+	armTest(t, o, kafka.TestConfigMessage{TestID: "test", TestType: "AVALANCHE"})
+
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "a", Sequence: 1})
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "b", Sequence: 1})
+	o.handleMetrics(kafka.MetricsMessage{Version: kafka.MetricsVersion, TestID: "test", NodeID: "a", Sequence: 2, Final: true})
+
+	o.failStalledTests(time.Now())
+	if state := testState(t, o, "test").State; state != TestRunning {
+		t.Fatalf("test is %s before timing out, want running", state)
+	}
+
+	o.failStalledTests(time.Now().Add(o.heartbeatTimeout))
+	test := testState(t, o, "test")
+	if test.State != TestFailed {
+		t.Fatalf("test is %s after timing out, want failed", test.State)
+	}
+	if want := "drivers b did not finish, no driver reported for 1m0s"; test.Reason != want {
+		t.Errorf("reason %q, want %q", test.Reason, want)
+	}
+	if len(o.testActivity) != 0 {
+		t.Errorf("still timing %d tests, want none", len(o.testActivity))
+	}
+}
+
+func TestAbortBeforeArming(t *testing.T) {
+	for _, state := range []TestState{TestCreated, TestConfigured} {
+		o := newTestOrchestrator(t)
+		storeTestConfig(t, o, kafka.TestConfigMessage{TestID: "test"})
+		if err := o.createTest("test", "AVALANCHE"); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.transitionTest("test", state, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// Without a trigger producer, sending an ABORT would panic
+		if err := o.abortTest(Abort{TestID: "test", Condition: "aborted on request"}); err != nil {
+			t.Fatalf("aborting a %s test: %v", state, err)
+		}
+		if got := testState(t, o, "test").State; got != TestAborted {
+			t.Errorf("%s test is %s once aborted, want aborted", state, got)
+		}
+		if err := o.moveTest("test", TestArmed, ""); err != errTestFinished {
+			t.Errorf("arming a test aborted while %s: %v, want %v", state, err, errTestFinished)
+		}
+	}
+}
+
+func TestAbortFinishedTestRecordsNothing(t *testing.T) {
+	o := newTestOrchestrator(t)
+	armTest(t, o, kafka.TestConfigMessage{TestID: "test", TestType: "AVALANCHE"})
+	if err := o.transitionTest("test", TestCompleted, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.abortTest(Abort{TestID: "test", Condition: "aborted on request"}); err != errTestFinished {
+		t.Errorf("aborting a completed test: %v, want %v", err, errTestFinished)
+	}
+	if _, err := o.abort("test"); err != badger.ErrKeyNotFound {
+		t.Errorf("completed test has an abort record: %v", err)
+	}
+}
+
+func TestStopBeforeArming(t *testing.T) {
+	o := newTestOrchestrator(t)
+	storeTestConfig(t, o, kafka.TestConfigMessage{TestID: "test"})
+	if err := o.createTest("test", "AVALANCHE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.transitionTest("test", TestConfigured, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.PauseTest("test"); err != errTestNotStarted {
+		t.Errorf("pausing a configured test: %v, want %v", err, errTestNotStarted)
+	}
+	if err := o.ResumeTest("test"); err != errTestNotStarted {
+		t.Errorf("resuming a configured test: %v, want %v", err, errTestNotStarted)
+	}
+
+	if err := o.StopTest("test", false); err != nil {
+		t.Fatal(err)
+	}
+	test := testState(t, o, "test")
+	if test.State != TestAborted || test.Reason != "stopped before it started" {
+		t.Errorf("stopped test is %s (%s), want aborted", test.State, test.Reason)
+	}
+	if err := o.moveTest("test", TestArmed, ""); err != errTestFinished {
+		t.Errorf("arming a stopped test: %v, want %v", err, errTestFinished)
+	}
+}
+
+func TestTriggerWhileTestInProgress(t *testing.T) {
+	o := newTestOrchestrator(t)
+	armTest(t, o, kafka.TestConfigMessage{TestID: "test", TestType: "AVALANCHE"})
+
+	// Refused before anything is sent, there are no producers to send with
+	_, err := o.TriggerLoadTestFromAPI(kafka.TestConfigMessage{TestType: "AVALANCHE"})
+	if !errors.Is(err, errTestInProgress) {
+		t.Errorf("triggering during a test: %v, want %v", err, errTestInProgress)
+	}
+	tests, err := o.tests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 1 {
+		t.Errorf("%d tests stored, want only the one in progress", len(tests))
+	}
+}
+
+func TestStuckNewTestFails(t *testing.T) {
+	o := newTestOrchestrator(t)
+	if err := o.createTest("test", "AVALANCHE"); err != nil {
+		t.Fatal(err)
+	}
+
+	o.failStalledTests(time.Now().Add(o.heartbeatTimeout))
+	if state := testState(t, o, "test").State; state != TestFailed {
+		t.Errorf("test created long ago is %s, want failed", state)
+	}
+	if len(o.testActivity) != 0 {
+		t.Errorf("still timing %d tests, want none", len(o.testActivity))
+	}
+}
@@ -0,0 +1,161 @@
+package orchestrator
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// errNoMetrics is returned when no driver has reported metrics for a test.
+var errNoMetrics = errors.New("no metrics reported for test")
+
+// TestSummary aggregates the metrics of every driver node in a test.
+// Latencies come from the merged histograms of all nodes and rates divide
+// the totals by the longest time a node has been running the test.
+// TargetRPS adds up the rates the nodes were last asked for, and Drivers
+// compares each node's achieved rate with its target.
+type TestSummary struct {
+	TestID                 string                       `json:"test_id"`
+	Nodes                  []string                     `json:"nodes"`
+	Requests               int64                        `json:"requests"`
+	Errors                 int64                        `json:"errors"`
+	ErrorRate              float64                      `json:"error_rate"`
+	RPS                    float64                      `json:"rps"`
+	TargetRPS              float64                      `json:"target_rps,omitempty"`
+	BytesSent              int64                        `json:"bytes_sent"`
+	BytesReceived          int64                        `json:"bytes_received"`
+	BytesSentPerSecond     float64                      `json:"bytes_sent_per_second"`
+	BytesReceivedPerSecond float64                      `json:"bytes_received_per_second"`
+	ElapsedSeconds         float64                      `json:"elapsed_seconds"`
+	Drivers                []DriverThroughput           `json:"drivers"`
+	Metrics                kafka.MetricsData            `json:"metrics"`
+	StageMetrics           map[string]kafka.MetricsData `json:"stage_metrics,omitempty"`
+	EndpointMetrics        map[string]kafka.MetricsData `json:"endpoint_metrics,omitempty"`
+	Checks                 map[string]kafka.CheckResult `json:"checks,omitempty"`
+}
+
+// DriverThroughput is the request rate one driver node achieved over the
+// test and the rate it was last asked for.
+type DriverThroughput struct {
+	NodeID    string  `json:"node_id"`
+	Requests  int64   `json:"requests"`
+	RPS       float64 `json:"rps"`
+	TargetRPS float64 `json:"target_rps,omitempty"`
+}
+
+// testMetrics returns the totals of the metrics each node reported for
+// testID.
+func (o *Orchestrator) testMetrics(testID string) ([]kafka.MetricsMessage, error) {
+	var allMetrics []kafka.MetricsMessage
+	err := o.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("metrics:" + testID + ":")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			metrics, err := kafka.DecodeMetricsMessage(val)
+			if err != nil {
+				return err
+			}
+			allMetrics = append(allMetrics, metrics)
+		}
+		return nil
+	})
+	return allMetrics, err
+}
+
+// nodeTestMetrics returns the totals of the metrics nodeID reported for
+// testID.
+func (o *Orchestrator) nodeTestMetrics(testID string, nodeID string) (kafka.MetricsMessage, error) {
+	var metrics kafka.MetricsMessage
+	err := o.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("metrics:" + testID + ":" + nodeID))
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		metrics, err = kafka.DecodeMetricsMessage(val)
+		return err
+	})
+	return metrics, err
+}
+
+// testSummary aggregates the metrics reported for testID.
+func (o *Orchestrator) testSummary(testID string) (TestSummary, error) {
+	allMetrics, err := o.testMetrics(testID)
+	if err != nil {
+		return TestSummary{}, err
+	}
+	if len(allMetrics) == 0 {
+		return TestSummary{}, errNoMetrics
+	}
+	return summarizeMetrics(testID, allMetrics), nil
+}
+
+// summarizeMetrics merges the metrics of each node in allMetrics.
+func summarizeMetrics(testID string, allMetrics []kafka.MetricsMessage) TestSummary {
+	summary := TestSummary{
+		TestID: testID,
+		Checks: sumChecks(allMetrics),
+	}
+
+	for _, metrics := range allMetrics {
+		summary.Nodes = append(summary.Nodes, metrics.NodeID)
+		summary.Metrics.Merge(metrics.Metrics)
+		if metrics.ElapsedSeconds > summary.ElapsedSeconds {
+			summary.ElapsedSeconds = metrics.ElapsedSeconds
+		}
+		summary.TargetRPS += metrics.TargetRPS
+		summary.Drivers = append(summary.Drivers, DriverThroughput{
+			NodeID:    metrics.NodeID,
+			Requests:  metrics.Metrics.Requests,
+			RPS:       metrics.RPS,
+			TargetRPS: metrics.TargetRPS,
+		})
+
+		for stage, data := range metrics.StageMetrics {
+			if summary.StageMetrics == nil {
+				summary.StageMetrics = make(map[string]kafka.MetricsData)
+			}
+			merged := summary.StageMetrics[stage]
+			merged.Merge(data)
+			summary.StageMetrics[stage] = merged
+		}
+		for endpoint, data := range metrics.EndpointMetrics {
+			if summary.EndpointMetrics == nil {
+				summary.EndpointMetrics = make(map[string]kafka.MetricsData)
+			}
+			merged := summary.EndpointMetrics[endpoint]
+			merged.Merge(data)
+			summary.EndpointMetrics[endpoint] = merged
+		}
+	}
+	sort.Strings(summary.Nodes)
+	sort.Slice(summary.Drivers, func(i, j int) bool {
+		return summary.Drivers[i].NodeID < summary.Drivers[j].NodeID
+	})
+
+	summary.Requests = summary.Metrics.Requests
+	summary.Errors = summary.Metrics.Errors
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+	}
+	summary.BytesSent = summary.Metrics.BytesSent
+	summary.BytesReceived = summary.Metrics.BytesReceived
+	if summary.ElapsedSeconds > 0 {
+		summary.RPS = float64(summary.Requests) / summary.ElapsedSeconds
+		summary.BytesSentPerSecond = float64(summary.BytesSent) / summary.ElapsedSeconds
+		summary.BytesReceivedPerSecond = float64(summary.BytesReceived) / summary.ElapsedSeconds
+	}
+	return summary
+}
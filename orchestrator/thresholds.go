@@ -0,0 +1,144 @@
+package orchestrator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// threshold is a condition on a test's aggregated results, such as
+// "p95 < 300ms", "error_rate < 1%" or "rps > 500".
+type threshold struct {
+	raw    string
+	metric string
+	op     string
+	value  float64 // microseconds for latencies, a fraction for rates
+}
+
+var thresholdPattern = regexp.MustCompile(`^\s*([a-z0-9_.]+)\s*(<=|>=|<|>)\s*(\S+)\s*$`)
+
+// latencyThresholdMetrics are the latency metrics thresholds can use.
+var latencyThresholdMetrics = map[string]bool{
+	"p50": true, "median": true, "p90": true, "p95": true, "p99": true, "p99.9": true, "p999": true,
+	"mean": true, "avg": true, "min": true, "max": true, "stddev": true,
+}
+
+// parseThreshold parses a threshold of the form "<metric> <op> <value>".
+// Latency metrics (p50/median, p90, p95, p99, p99.9/p999, mean/avg, min,
+// max, stddev) take a duration. error_rate and check_rate take a percentage
+// or a fraction. rps, requests and errors take a number. op is one of <, <=,
+// > and >=.
+func parseThreshold(raw string) (threshold, error) {
+	match := thresholdPattern.FindStringSubmatch(raw)
+	if match == nil {
+		return threshold{}, fmt.Errorf("threshold %q: expected \"<metric> <op> <value>\"", raw)
+	}
+	t := threshold{raw: raw, metric: match[1], op: match[2]}
+	value := match[3]
+
+	switch {
+	case latencyThresholdMetrics[t.metric]:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return threshold{}, fmt.Errorf("threshold %q: %s needs a duration such as 300ms", raw, t.metric)
+		}
+		t.value = float64(d.Microseconds())
+	case t.metric == "error_rate" || t.metric == "check_rate":
+		rate, err := parseRate(value)
+		if err != nil {
+			return threshold{}, fmt.Errorf("threshold %q: %s needs a percentage or fraction", raw, t.metric)
+		}
+		t.value = rate
+	case t.metric == "rps" || t.metric == "requests" || t.metric == "errors":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return threshold{}, fmt.Errorf("threshold %q: %s needs a number", raw, t.metric)
+		}
+		t.value = n
+	default:
+		return threshold{}, fmt.Errorf("threshold %q: unknown metric %q", raw, t.metric)
+	}
+	return t, nil
+}
+
+// parseRate parses a percentage such as "1%" or a fraction such as "0.01".
+func parseRate(value string) (float64, error) {
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return percent / 100, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// actual returns the value of the threshold's metric in summary, in the unit
+// of its value.
+func (t threshold) actual(summary TestSummary) float64 {
+	m := summary.Metrics
+	switch t.metric {
+	case "p50", "median":
+		return float64(m.MedianLatencyUs)
+	case "p90":
+		return float64(m.P90LatencyUs)
+	case "p95":
+		return float64(m.P95LatencyUs)
+	case "p99":
+		return float64(m.P99LatencyUs)
+	case "p99.9", "p999":
+		return float64(m.P999LatencyUs)
+	case "mean", "avg":
+		return float64(m.MeanLatencyUs)
+	case "min":
+		return float64(m.MinLatencyUs)
+	case "max":
+		return float64(m.MaxLatencyUs)
+	case "stddev":
+		return float64(m.StdDevLatencyUs)
+	case "error_rate":
+		return summary.ErrorRate
+	case "check_rate":
+		var passes, total int64
+		for _, result := range summary.Checks {
+			passes += result.Passes
+			total += result.Passes + result.Fails
+		}
+		if total == 0 {
+			return 1
+		}
+		return float64(passes) / float64(total)
+	case "rps":
+		return summary.RPS
+	case "requests":
+		return float64(summary.Requests)
+	case "errors":
+		return float64(summary.Errors)
+	}
+	return 0
+}
+
+// holds reports whether actual satisfies the threshold.
+func (t threshold) holds(actual float64) bool {
+	switch t.op {
+	case "<":
+		return actual < t.value
+	case "<=":
+		return actual <= t.value
+	case ">":
+		return actual > t.value
+	default:
+		return actual >= t.value
+	}
+}
+
+// formatActual formats a value of the threshold's metric for people.
+func (t threshold) formatActual(actual float64) string {
+	switch {
+	case latencyThresholdMetrics[t.metric]:
+		return (time.Duration(actual) * time.Microsecond).String()
+	case t.metric == "error_rate" || t.metric == "check_rate":
+		return strconv.FormatFloat(actual*100, 'f', 2, 64) + "%"
+	default:
+		return strconv.FormatFloat(actual, 'f', -1, 64)
+	}
+}
@@ -0,0 +1,149 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		raw    string
+		metric string
+		op     string
+		value  float64
+	}{
+		{"p95 < 300ms", "p95", "<", 300000},
+		{"p99.9<=1s", "p99.9", "<=", 1000000},
+		{"  median >= 2ms  ", "median", ">=", 2000},
+		{"max > 1.5s", "max", ">", 1500000},
+		{"error_rate < 1%", "error_rate", "<", 0.01},
+		{"error_rate < 0.05", "error_rate", "<", 0.05},
+		{"check_rate >= 99.5%", "check_rate", ">=", 0.995},
+		{"rps > 500", "rps", ">", 500},
+		{"requests >= 1e3", "requests", ">=", 1000},
+		{"errors <= 0", "errors", "<=", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseThreshold(tt.raw)
+		if err != nil {
+			t.Errorf("parseThreshold(%q): %v", tt.raw, err)
+			continue
+		}
+		if got.metric != tt.metric || got.op != tt.op || got.value != tt.value || got.raw != tt.raw {
+			t.Errorf("parseThreshold(%q) = %+v, want %s %s %v", tt.raw, got, tt.metric, tt.op, tt.value)
+		}
+	}
+}
+
+func TestParseThresholdInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"p95",
+		"p95 300ms",
+		"p95 == 300ms",
+		"p95 < 300",
+		"p95 < fast",
+		"p95 < 300 ms",
+		"latency < 300ms",
+		"P95 < 300ms",
+		"error_rate < lots",
+		"error_rate < %",
+		"rps > many",
+		"rps > 500/s",
+	}
+	for _, raw := range tests {
+		if got, err := parseThreshold(raw); err == nil {
+			t.Errorf("parseThreshold(%q) = %+v, want an error", raw, got)
+		}
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	summary := TestSummary{
+		TestID:    "test",
+		Requests:  1000,
+		Errors:    20,
+		ErrorRate: 0.02,
+		RPS:       250,
+		Metrics: kafka.MetricsData{
+			MedianLatencyUs: 80000,
+			P95LatencyUs:    250000,
+			P99LatencyUs:    400000,
+			MaxLatencyUs:    900000,
+		},
+		Checks: map[string]kafka.CheckResult{
+			"status is 200": {Passes: 990, Fails: 10},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds []string
+		passed     bool
+		failed     []string
+	}{
+		{"none", nil, true, nil},
+		{"latency holds", []string{"p95 < 300ms", "median <= 80ms"}, true, nil},
+		{"latency fails", []string{"p95 < 300ms", "p99 < 300ms"}, false, []string{"p99 < 300ms"}},
+		{"bound is exclusive", []string{"max < 900ms"}, false, []string{"max < 900ms"}},
+		{"error rate holds", []string{"error_rate < 5%"}, true, nil},
+		{"error rate fails", []string{"error_rate < 1%"}, false, []string{"error_rate < 1%"}},
+		{"check rate", []string{"check_rate >= 99%", "check_rate > 99%"}, false, []string{"check_rate > 99%"}},
+		{"counts", []string{"rps > 200", "requests >= 1000", "errors < 10"}, false, []string{"errors < 10"}},
+	}
+	for _, tt := range tests {
+		verdict, err := evaluateThresholds(tt.thresholds, summary)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if verdict.Passed != tt.passed {
+			t.Errorf("%s: passed = %v, want %v", tt.name, verdict.Passed, tt.passed)
+		}
+		if len(verdict.Failed) != len(tt.failed) {
+			t.Errorf("%s: failed = %v, want %v", tt.name, verdict.Failed, tt.failed)
+			continue
+		}
+		for i := range tt.failed {
+			if verdict.Failed[i] != tt.failed[i] {
+				t.Errorf("%s: failed = %v, want %v", tt.name, verdict.Failed, tt.failed)
+				break
+			}
+		}
+		if len(verdict.Thresholds) != len(tt.thresholds) {
+			t.Errorf("%s: %d threshold results, want %d", tt.name, len(verdict.Thresholds), len(tt.thresholds))
+		}
+	}
+}
+
+func TestEvaluateThresholdsActual(t *testing.T) {
+	summary := TestSummary{ErrorRate: 0.0125, RPS: 42.5, Metrics: kafka.MetricsData{P95LatencyUs: 312000}}
+	verdict, err := evaluateThresholds([]string{"p95 < 300ms", "error_rate < 1%", "rps > 40"}, summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"312ms", "1.25%", "42.5"}
+	for i, result := range verdict.Thresholds {
+		if result.Actual != want[i] {
+			t.Errorf("%s: actual %q, want %q", result.Threshold, result.Actual, want[i])
+		}
+	}
+}
+
+func TestEvaluateThresholdsInvalid(t *testing.T) {
+	if _, err := evaluateThresholds([]string{"p95 < 300ms", "p95 < soon"}, TestSummary{}); err == nil {
+		t.Error("want an error for an invalid threshold")
+	}
+}
+
+func TestCheckRateWithoutChecks(t *testing.T) {
+	verdict, err := evaluateThresholds([]string{"check_rate >= 100%"}, TestSummary{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verdict.Passed {
+		t.Errorf("check_rate without checks failed: %+v", verdict.Thresholds)
+	}
+}
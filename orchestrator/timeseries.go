@@ -0,0 +1,121 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// TimeSeriesPoint is the metrics of one window of a test.
+type TimeSeriesPoint struct {
+	NodeID        string            `json:"node_id,omitempty"`
+	Sequence      int64             `json:"sequence,omitempty"`
+	WindowStartMs int64             `json:"window_start_ms"`
+	WindowEndMs   int64             `json:"window_end_ms"`
+	RPS           float64           `json:"rps"`
+	TargetRPS     float64           `json:"target_rps,omitempty"`
+	ErrorRate     float64           `json:"error_rate"`
+	Metrics       kafka.MetricsData `json:"metrics"`
+}
+
+// TimeSeries is the windowed metrics of a test, per node and for the whole
+// cluster. Nodes end their windows on the same multiples of the metrics
+// interval, so the cluster series merges the windows of all nodes ending at
+// the same time.
+type TimeSeries struct {
+	TestID  string                       `json:"test_id"`
+	Nodes   map[string][]TimeSeriesPoint `json:"nodes"`
+	Cluster []TimeSeriesPoint            `json:"cluster"`
+}
+
+// storeMetricsWindow adds a window of metrics to the time series of its test
+// and node.
+func (o *Orchestrator) storeMetricsWindow(metrics kafka.MetricsMessage) error {
+	metricsJSON, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	// The zero padded sequence keeps the windows of a node in order
+	key := []byte(fmt.Sprintf("timeseries:%s:%s:%010d", metrics.TestID, metrics.NodeID, metrics.Sequence))
+	return o.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, metricsJSON)
+	})
+}
+
+// testTimeSeries returns the time series of testID.
+func (o *Orchestrator) testTimeSeries(testID string) (TimeSeries, error) {
+	series := TimeSeries{
+		TestID: testID,
+		Nodes:  make(map[string][]TimeSeriesPoint),
+	}
+	cluster := make(map[int64]*TimeSeriesPoint)
+
+	err := o.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte("timeseries:" + testID + ":")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			window, err := kafka.DecodeMetricsMessage(val)
+			if err != nil {
+				return err
+			}
+
+			point := newTimeSeriesPoint(window.WindowStartMs, window.WindowEndMs, window.Metrics)
+			point.NodeID = window.NodeID
+			point.Sequence = window.Sequence
+			point.TargetRPS = window.TargetRPS
+			series.Nodes[window.NodeID] = append(series.Nodes[window.NodeID], point)
+
+			total, ok := cluster[window.WindowEndMs]
+			if !ok {
+				total = &TimeSeriesPoint{WindowStartMs: window.WindowStartMs, WindowEndMs: window.WindowEndMs}
+				cluster[window.WindowEndMs] = total
+			}
+			if window.WindowStartMs < total.WindowStartMs {
+				total.WindowStartMs = window.WindowStartMs
+			}
+			total.Metrics.Merge(window.Metrics)
+			total.TargetRPS += window.TargetRPS
+		}
+		return nil
+	})
+	if err != nil {
+		return TimeSeries{}, err
+	}
+
+	for _, total := range cluster {
+		point := newTimeSeriesPoint(total.WindowStartMs, total.WindowEndMs, total.Metrics)
+		point.TargetRPS = total.TargetRPS
+		series.Cluster = append(series.Cluster, point)
+	}
+	sort.Slice(series.Cluster, func(i, j int) bool {
+		return series.Cluster[i].WindowEndMs < series.Cluster[j].WindowEndMs
+	})
+	return series, nil
+}
+
+// newTimeSeriesPoint computes the rates of a window from its metrics.
+func newTimeSeriesPoint(startMs int64, endMs int64, metrics kafka.MetricsData) TimeSeriesPoint {
+	point := TimeSeriesPoint{
+		WindowStartMs: startMs,
+		WindowEndMs:   endMs,
+		Metrics:       metrics,
+	}
+	if endMs > startMs {
+		point.RPS = float64(metrics.Requests) / (float64(endMs-startMs) / 1000)
+	}
+	if metrics.Requests > 0 {
+		point.ErrorRate = float64(metrics.Errors) / float64(metrics.Requests)
+	}
+	return point
+}
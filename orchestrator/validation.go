@@ -0,0 +1,360 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+// minMetricsInterval is the shortest window drivers may report metrics for,
+// shorter ones flood the metrics topic.
+const minMetricsInterval = 100 * time.Millisecond
+
+// validateTestConfig checks that a test config carries the parameters its test type needs.
+// Tests that report no metrics for stallTimeout are failed, so metrics windows
+// must be well within it.
+func validateTestConfig(config kafka.TestConfigMessage, stallTimeout time.Duration) error {
+	switch config.TestType {
+	case "AVALANCHE":
+		if config.MessageCountPerDriver <= 0 {
+			return errors.New("message_count_per_driver must be positive")
+		}
+	case "TSUNAMI":
+		if config.TestMessageDelay <= 0 {
+			return errors.New("test_message_delay must be positive")
+		}
+		if config.MessageCountPerDriver <= 0 && config.DurationSeconds <= 0 {
+			return errors.New("message_count_per_driver or duration_seconds must be set")
+		}
+	case "RAMP":
+		if config.RampStartRPS < 0 {
+			return errors.New("ramp_start_rps must not be negative")
+		}
+		if config.RampTargetRPS <= 0 {
+			return errors.New("ramp_target_rps must be positive")
+		}
+		if config.RampDurationSeconds <= 0 {
+			return errors.New("ramp_duration_seconds must be positive")
+		}
+		if config.HoldDurationSeconds < 0 {
+			return errors.New("hold_duration_seconds must not be negative")
+		}
+	case "STAGED":
+		if err := validateStages(config.Stages); err != nil {
+			return err
+		}
+	case "CONSTANT_ARRIVAL_RATE":
+		if config.ArrivalRate <= 0 {
+			return errors.New("arrival_rate must be positive")
+		}
+		if config.MessageCountPerDriver <= 0 && config.DurationSeconds <= 0 {
+			return errors.New("message_count_per_driver or duration_seconds must be set")
+		}
+	case "VIRTUAL_USERS":
+		if config.VirtualUsers <= 0 {
+			return errors.New("virtual_users must be positive")
+		}
+		if config.IterationsPerUser < 0 {
+			return errors.New("iterations_per_user must not be negative")
+		}
+		if config.IterationsPerUser == 0 && config.DurationSeconds == 0 {
+			return errors.New("iterations_per_user or duration_seconds must be set")
+		}
+		if err := validateThinkTime(config.ThinkTime); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown test_type %q", config.TestType)
+	}
+
+	if config.MaxInFlight < 0 {
+		return errors.New("max_in_flight must not be negative")
+	}
+	if config.DurationSeconds < 0 {
+		return errors.New("duration_seconds must not be negative")
+	}
+	if config.GracefulDrainSeconds < 0 {
+		return errors.New("graceful_drain_seconds must not be negative")
+	}
+	if config.MetricsIntervalMs < 0 {
+		return errors.New("metrics_interval_ms must not be negative")
+	}
+	if config.MetricsIntervalMs > 0 {
+		interval := time.Duration(config.MetricsIntervalMs) * time.Millisecond
+		if interval < minMetricsInterval {
+			return fmt.Errorf("metrics_interval_ms must be at least %d", minMetricsInterval.Milliseconds())
+		}
+		// Leave room for a late window before the test is taken for stalled
+		if stallTimeout > 0 && interval > stallTimeout/2 {
+			return fmt.Errorf("metrics_interval_ms must be at most %d, half the %s stall timeout", (stallTimeout / 2).Milliseconds(), stallTimeout)
+		}
+	}
+	for _, raw := range config.Thresholds {
+		if _, err := parseThreshold(raw); err != nil {
+			return err
+		}
+	}
+	for _, raw := range config.AbortOn {
+		if _, err := parseAbortCondition(raw); err != nil {
+			return err
+		}
+	}
+	if err := validateArrival(config.Arrival); err != nil {
+		return err
+	}
+	if err := validateDataFeed(config.DataFeed); err != nil {
+		return err
+	}
+
+	switch {
+	case len(config.Steps) > 0:
+		if err := validateRequestSpecs("steps", config.Steps, config.TestServer); err != nil {
+			return err
+		}
+	case len(config.Requests) > 0:
+		if err := validateRequestSpecs("requests", config.Requests, config.TestServer); err != nil {
+			return err
+		}
+	default:
+		if err := validateRequestSpec(config.Request, config.TestServer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateStages checks that every stage has a duration and drives either a
+// request rate or a number of concurrent workers, but not both.
+func validateStages(stages []kafka.Stage) error {
+	if len(stages) == 0 {
+		return errors.New("stages must not be empty")
+	}
+
+	names := make(map[string]bool, len(stages))
+	for i, stage := range stages {
+		if stage.DurationSeconds <= 0 {
+			return fmt.Errorf("stage %d: duration_seconds must be positive", i+1)
+		}
+		if stage.TargetRPS < 0 {
+			return fmt.Errorf("stage %d: target_rps must not be negative", i+1)
+		}
+		if stage.Concurrency < 0 {
+			return fmt.Errorf("stage %d: concurrency must not be negative", i+1)
+		}
+		if stage.TargetRPS > 0 && stage.Concurrency > 0 {
+			return fmt.Errorf("stage %d: set either target_rps or concurrency, not both", i+1)
+		}
+		if stage.Name != "" {
+			if names[stage.Name] {
+				return fmt.Errorf("stage %d: duplicate stage name %q", i+1, stage.Name)
+			}
+			names[stage.Name] = true
+		}
+	}
+	return nil
+}
+
+// validateThinkTime checks that a think time uses a known distribution with
+// the parameters that distribution needs. A missing think time means no pause.
+func validateThinkTime(thinkTime *kafka.ThinkTime) error {
+	if thinkTime == nil {
+		return nil
+	}
+
+	switch thinkTime.Distribution {
+	case "fixed", "exponential":
+		if thinkTime.DurationMs < 0 {
+			return errors.New("think_time: duration_ms must not be negative")
+		}
+	case "uniform":
+		if thinkTime.MinMs < 0 || thinkTime.MaxMs < thinkTime.MinMs {
+			return errors.New("think_time: need 0 <= min_ms <= max_ms")
+		}
+	default:
+		return fmt.Errorf("think_time: unknown distribution %q", thinkTime.Distribution)
+	}
+	return nil
+}
+
+// validateArrival checks that an arrival distribution is known and has the
+// parameters it needs. A missing distribution means evenly spaced requests.
+func validateArrival(arrival *kafka.ArrivalDistribution) error {
+	if arrival == nil {
+		return nil
+	}
+
+	switch arrival.Type {
+	case "constant", "poisson":
+	case "uniform":
+		if arrival.JitterPercent < 0 || arrival.JitterPercent > 100 {
+			return errors.New("arrival: jitter_percent must be between 0 and 100")
+		}
+	case "burst":
+		if arrival.BurstSize < 1 {
+			return errors.New("arrival: burst_size must be positive")
+		}
+	default:
+		return fmt.Errorf("arrival: unknown type %q", arrival.Type)
+	}
+	return nil
+}
+
+// validateDataFeed checks that a data feed uses a known format and mode and
+// holds at least one row. A missing feed is valid.
+func validateDataFeed(feed *kafka.DataFeed) error {
+	if feed == nil {
+		return nil
+	}
+
+	switch feed.Mode {
+	case "sequential", "random", "unique":
+	default:
+		return fmt.Errorf("data_feed: unknown mode %q", feed.Mode)
+	}
+
+	rows, err := feed.Rows()
+	if err != nil {
+		return fmt.Errorf("data_feed: %v", err)
+	}
+	if len(rows) == 0 {
+		return errors.New("data_feed: no rows")
+	}
+	return nil
+}
+
+// maxTestConfigBytes is how large an encoded test config may be. Producers
+// drop messages over their MaxMessageBytes, 1000000 by default, without the
+// orchestrator noticing; the rest is left for the test id.
+const maxTestConfigBytes = 1000000 - 1024
+
+// validateTestConfigSize checks that config, once its data feed is
+// partitioned, fits in the single message it is sent to drivers in.
+func validateTestConfigSize(config kafka.TestConfigMessage) error {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if len(encoded) > maxTestConfigBytes {
+		return fmt.Errorf("test config is %d bytes once encoded, at most %d can be sent to drivers; shrink its data_feed", len(encoded), maxTestConfigBytes)
+	}
+	return nil
+}
+
+// validateRequestSpec checks that a request spec resolves to a usable HTTP
+// request. A missing spec means a GET of testServer.
+func validateRequestSpec(spec *kafka.RequestSpec, testServer string) error {
+	if spec == nil {
+		spec = &kafka.RequestSpec{}
+	}
+
+	rawURL := spec.URL
+	if rawURL == "" {
+		rawURL = testServer
+	}
+	if rawURL == "" {
+		return errors.New("test_server or request url must be set")
+	}
+	// URLs built from variables can only be checked once they are rendered
+	if !strings.Contains(rawURL, "{{") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("request: invalid url %q: %v", rawURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("request: url %q must be http or https", rawURL)
+		}
+	}
+
+	if strings.ContainsAny(spec.Method, " \t\r\n") {
+		return fmt.Errorf("request: invalid method %q", spec.Method)
+	}
+	if spec.Body != "" && spec.BodyBase64 != "" {
+		return errors.New("request: set either body or body_base64, not both")
+	}
+
+	for _, e := range spec.Extract {
+		if e.Name == "" {
+			return errors.New("request: extract name must be set")
+		}
+		if e.Expression == "" && e.From != "json" {
+			return fmt.Errorf("request: extract %s: expression must be set", e.Name)
+		}
+		switch e.From {
+		case "json", "header", "regex":
+		default:
+			return fmt.Errorf("request: extract %s: unknown source %q", e.Name, e.From)
+		}
+	}
+
+	for i, check := range spec.Checks {
+		if err := validateCheck(check); err != nil {
+			return fmt.Errorf("request: checks[%d]: %v", i, err)
+		}
+	}
+
+	// Parse the templates, binary body and regular expressions as drivers will
+	if _, err := kafka.ParseRequestSpec(*spec, testServer, kafka.TemplateFuncs("")); err != nil {
+		return fmt.Errorf("request: %v", err)
+	}
+	return nil
+}
+
+// validateCheck checks that a response check has what its type needs.
+func validateCheck(check kafka.Check) error {
+	switch check.Type {
+	case "status":
+		for _, status := range check.Status {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("invalid status %d", status)
+			}
+		}
+	case "body_contains":
+		if check.Value == "" {
+			return errors.New("value must be set")
+		}
+	case "body_regex":
+	case "json_path":
+		if check.Path == "" {
+			return errors.New("path must be set")
+		}
+	case "max_latency":
+		if check.MaxLatencyMs <= 0 {
+			return errors.New("max_latency_ms must be greater than 0")
+		}
+	case "max_body_size":
+		if check.MaxBytes < 0 {
+			return errors.New("max_bytes must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", check.Type)
+	}
+	return nil
+}
+
+// validateRequestSpecs checks each request of a weighted multi-endpoint
+// scenario or journey, reported under field, and that their names do not
+// collide.
+func validateRequestSpecs(field string, specs []kafka.RequestSpec, testServer string) error {
+	names := make(map[string]bool, len(specs))
+	for i := range specs {
+		spec := &specs[i]
+		if err := validateRequestSpec(spec, testServer); err != nil {
+			return fmt.Errorf("%s[%d]: %v", field, i, err)
+		}
+		if spec.Weight < 0 {
+			return fmt.Errorf("%s[%d]: weight must not be negative", field, i)
+		}
+		if spec.Name != "" {
+			if names[spec.Name] {
+				return fmt.Errorf("%s[%d]: duplicate name %q", field, i, spec.Name)
+			}
+			names[spec.Name] = true
+		}
+	}
+	return nil
+}
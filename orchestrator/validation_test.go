@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+)
+
+func TestValidateMetricsInterval(t *testing.T) {
+	tests := []struct {
+		intervalMs int
+		valid      bool
+	}{
+		{0, true},
+		{100, true},
+		{1000, true},
+		{30000, true},
+		{-1, false},
+		{1, false},
+		{99, false},
+		{30001, false},
+		{60000, false},
+	}
+	for _, tt := range tests {
+		config := kafka.TestConfigMessage{
+			TestType:              "AVALANCHE",
+			TestServer:            "http://server",
+			MessageCountPerDriver: 1,
+			MetricsIntervalMs:     tt.intervalMs,
+		}
+		err := validateTestConfig(config, time.Minute)
+		if tt.valid && err != nil {
+			t.Errorf("metrics_interval_ms %d: %v", tt.intervalMs, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("metrics_interval_ms %d: want an error", tt.intervalMs)
+		}
+	}
+}
+
+func TestValidateMetricsIntervalWithoutStallTimeout(t *testing.T) {
+	config := kafka.TestConfigMessage{
+		TestType:              "AVALANCHE",
+		TestServer:            "http://server",
+		MessageCountPerDriver: 1,
+		MetricsIntervalMs:     int(time.Hour.Milliseconds()),
+	}
+	if err := validateTestConfig(config, 0); err != nil {
+		t.Errorf("long interval without a stall timeout: %v", err)
+	}
+}
+
+func TestValidateTestConfigSize(t *testing.T) {
+	rows := strings.Repeat("alice,secret\n", 100)
+	config := kafka.TestConfigMessage{
+		TestType:   "AVALANCHE",
+		TestServer: "http://server",
+		DataFeed:   &kafka.DataFeed{Format: "csv", Mode: "unique", Data: "user,password\n" + rows},
+	}
+	if err := validateTestConfigSize(config); err != nil {
+		t.Errorf("small data feed: %v", err)
+	}
+
+	config.DataFeed.Data = "user,password\n" + strings.Repeat(rows, 1000)
+	if err := validateTestConfigSize(config); err == nil {
+		t.Error("1.3MB data feed: want an error")
+	}
+}
@@ -0,0 +1,150 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ankush-003/distributed-load-testing/kafka"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// Verdict is whether a test met the thresholds of its config. It is
+// re-evaluated as drivers finish and is Complete once every driver that
+// reported on the test has. An aborted test, or one a driver could not run,
+// never passes.
+type Verdict struct {
+	TestID       string            `json:"test_id"`
+	Passed       bool              `json:"passed"`
+	Complete     bool              `json:"complete"`
+	Failed       []string          `json:"failed,omitempty"`
+	Aborted      bool              `json:"aborted"`
+	AbortReason  string            `json:"abort_reason,omitempty"`
+	DriverErrors []string          `json:"driver_errors,omitempty"` // why drivers could not run the test, as "<node>: <error>"
+	Thresholds   []ThresholdResult `json:"thresholds"`
+	EvaluatedAt  string            `json:"evaluated_at"`
+}
+
+// ThresholdResult is the outcome of one threshold.
+type ThresholdResult struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+// evaluateThresholds checks summary against each of thresholds.
+func evaluateThresholds(thresholds []string, summary TestSummary) (Verdict, error) {
+	verdict := Verdict{
+		TestID:      summary.TestID,
+		Passed:      true,
+		Thresholds:  []ThresholdResult{},
+		EvaluatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	for _, raw := range thresholds {
+		t, err := parseThreshold(raw)
+		if err != nil {
+			return Verdict{}, err
+		}
+		actual := t.actual(summary)
+		result := ThresholdResult{
+			Threshold: raw,
+			Actual:    t.formatActual(actual),
+			Passed:    t.holds(actual),
+		}
+		if !result.Passed {
+			verdict.Passed = false
+			verdict.Failed = append(verdict.Failed, raw)
+		}
+		verdict.Thresholds = append(verdict.Thresholds, result)
+	}
+	return verdict, nil
+}
+
+// updateVerdict evaluates the thresholds of testID against its current
+// results, stores the verdict and returns it. The caller must hold o.mu.
+func (o *Orchestrator) updateVerdict(testID string) (Verdict, error) {
+	testConfig, err := o.testConfig(testID)
+	if err == badger.ErrKeyNotFound {
+		// Not triggered by this orchestrator, there is nothing to evaluate against
+		return Verdict{}, nil
+	}
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	allMetrics, err := o.testMetrics(testID)
+	if err != nil || len(allMetrics) == 0 {
+		return Verdict{}, err
+	}
+
+	verdict, err := evaluateThresholds(testConfig.Thresholds, summarizeMetrics(testID, allMetrics))
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	// An aborted test fails whatever its thresholds say
+	abort, err := o.abort(testID)
+	if err != nil && err != badger.ErrKeyNotFound {
+		return Verdict{}, err
+	}
+	if err == nil {
+		verdict.Passed = false
+		verdict.Aborted = true
+		verdict.AbortReason = abort.reason()
+	}
+
+	// Complete once every driver that acknowledged the test, by reporting
+	// an empty window when it started, has reported its last window. Drivers
+	// that never acknowledged are not waited for, and the test times out if
+	// one that did stops reporting.
+	finished := 0
+	for _, metrics := range allMetrics {
+		if metrics.Final {
+			finished++
+		}
+		if metrics.Error != "" {
+			verdict.Passed = false
+			verdict.DriverErrors = append(verdict.DriverErrors, metrics.NodeID+": "+metrics.Error)
+		}
+	}
+	verdict.Complete = finished == len(allMetrics)
+
+	verdictJSON, err := json.Marshal(verdict)
+	if err != nil {
+		return Verdict{}, err
+	}
+	err = o.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("verdict:"+testID), verdictJSON)
+	})
+	return verdict, err
+}
+
+// testConfig returns the config testID was triggered with.
+func (o *Orchestrator) testConfig(testID string) (kafka.TestConfigMessage, error) {
+	var testConfig kafka.TestConfigMessage
+	err := o.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("testconfig:" + testID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &testConfig)
+		})
+	})
+	return testConfig, err
+}
+
+// verdict returns the stored verdict of testID.
+func (o *Orchestrator) verdict(testID string) (Verdict, error) {
+	var verdict Verdict
+	err := o.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("verdict:" + testID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &verdict)
+		})
+	})
+	return verdict, err
+}
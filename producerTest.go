@@ -32,26 +32,28 @@ func main() {
 
 	messages := []kafka.MetricsMessage{
 		{
+			Version:  kafka.MetricsVersion,
 			NodeID:   "node1",
 			TestID:   "test1",
 			ReportID: "report1",
 			Metrics: kafka.MetricsData{
-				MeanLatency:   "1",
-				MedianLatency: "2",
-				MinLatency:    "3",
-				MaxLatency:    "4",
+				MeanLatencyUs:   1,
+				MedianLatencyUs: 2,
+				MinLatencyUs:    3,
+				MaxLatencyUs:    4,
 			},
 
 		},
 		{
+			Version:  kafka.MetricsVersion,
 			NodeID:   "node2",
 			TestID:   "test2",
 			ReportID: "report2",
 			Metrics: kafka.MetricsData{
-				MeanLatency:   "5",
-				MedianLatency: "6",
-				MinLatency:    "7",
-				MaxLatency:    "8",
+				MeanLatencyUs:   5,
+				MedianLatencyUs: 6,
+				MinLatencyUs:    7,
+				MaxLatencyUs:    8,
 			},
 		},
 	}